@@ -25,6 +25,16 @@ func main() {
 	rootCmd.Flags().UintVar(&opt.CloudEventsPort, "cloud-events-port", 7787, "Cloud Events Port")
 	rootCmd.Flags().IntVar(&opt.MetricsPort, "metrics-port", 7788, "Operator Metrics Port")
 	rootCmd.Flags().IntVar(&opt.HealthPort, "health-port", 7789, "Operator Health Port")
+	rootCmd.Flags().StringVar(&opt.HttpService, "http-service", "", "Http Server Service namespace/name, which ingress of sensors routes to")
+	rootCmd.Flags().IntVar(&opt.HttpServicePort, "http-service-port", 80, "Http Server Service Port")
+	rootCmd.Flags().IntVar(&opt.TLSPort, "tls-port", 0, "Https Server Port, 0 means disabled")
+	rootCmd.Flags().StringVar(&opt.TLSCertFile, "tls-cert", "", "Https Server Default TLS Cert File")
+	rootCmd.Flags().StringVar(&opt.TLSKeyFile, "tls-key", "", "Https Server Default TLS Key File")
+	rootCmd.Flags().IntVar(&opt.ExternalMetricsPort, "external-metrics-port", 0, "External Metrics API Port, 0 means disabled")
+	rootCmd.Flags().StringVar(&opt.ExternalMetricsCertFile, "external-metrics-cert", "", "External Metrics API TLS Cert File, self signed if empty")
+	rootCmd.Flags().StringVar(&opt.ExternalMetricsKeyFile, "external-metrics-key", "", "External Metrics API TLS Key File, self signed if empty")
+	rootCmd.Flags().IntVar(&opt.ActorConcurrency, "actor-concurrency", 100, "Max Concurrent Actor Executions, 0 means no limit")
+	rootCmd.Flags().BoolVar(&opt.CrossNamespaceWatch, "k8s-watch-cross-namespace", false, "Allow K8s Watch and K8s Events Triggers to Watch Other Namespaces or All Namespaces by *")
 	rootCmd.Flags().BoolVar(&opt.Debug, "debug", false, "Enable Debug")
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Printf("exit with err: %s \n", err)
@@ -0,0 +1,11 @@
+package consts
+
+// env of event injected into containers of created workloads
+const (
+	EnvEventUUID      = "EVENTRIGGER_UUID"
+	EnvEventNamespace = "EVENTRIGGER_EVENT_NAMESPACE"
+	EnvEventType      = "EVENTRIGGER_EVENT_TYPE"
+	EnvEventSource    = "EVENTRIGGER_EVENT_SOURCE"
+	EnvEventData      = "EVENTRIGGER_EVENT_DATA"
+	EnvEventVersion   = "EVENTRIGGER_EVENT_VERSION"
+)
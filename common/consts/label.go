@@ -10,12 +10,21 @@ const (
 
 	UUIDLabel = "eventrigger.com/pod-uuid"
 
-	ScaleToZeroEnable   = "eventrigger.com/scale-to-zero-enable"
-	ScaleToZeroIdleTime = "eventrigger.com/scale-to-zero-idle-time"
+	// activity state of sensor persisted on scaled object
+	LastEventTimeAnnotation = "eventrigger.com/last-event-time"
+	EventCountAnnotation    = "eventrigger.com/event-count"
 
+	// ScaleByHPAAnnotation marks sensor whose scaled object is scaled by hpa on external metrics,
+	// operator publishes metrics and creates the object but never sets its replicas then
+	ScaleByHPAAnnotation = "eventrigger.com/scale-by-hpa"
+
+	// ingress routing hosts of sensor to operator http service, name defaults to name of sensor
 	InjectIngressEnable = "eventrigger.com/ingress-enable"
 	InjectIngressName   = "eventrigger.com/ingress-name"
+	InjectIngressClass  = "eventrigger.com/ingress-class"
 
+	// istio virtual service routing hosts of sensor to operator http service, gateways are separated by comma
 	InjectIstioEnable         = "eventrigger.com/istio-enable"
 	InjectIstioVirtualService = "eventrigger.com/istio-virtual-service"
+	InjectIstioGateway        = "eventrigger.com/istio-gateway"
 )
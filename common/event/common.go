@@ -1,6 +1,8 @@
 package event
 
 import (
+	"encoding/json"
+	"github.com/pkg/errors"
 	uuid2 "k8s.io/apimachinery/pkg/util/uuid"
 	"strconv"
 	"time"
@@ -12,6 +14,8 @@ type Event struct {
 	Type      string `json:"type" yaml:"type"`
 	Version   string `json:"version" yaml:"version"`
 	Data      string `json:"data" yaml:"data"`
+	// Key is the message key of source, e.g. kafka message key
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
 	// Create Options
 	UUID string `json:"uuid" yaml:"uuid"`
 }
@@ -51,3 +55,17 @@ func NewEvent(namespace, eventType, source, version, data, uuid string) Event {
 	}
 	return event
 }
+
+// NewBatchEvent aggregates events into one event whose data is a json array of events,
+// namespace, type and source are taken from the first event.
+func NewBatchEvent(events []Event) (Event, error) {
+	if len(events) == 0 {
+		return Event{}, errors.New("batch events is empty")
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		return Event{}, errors.Wrap(err, "marshal batch events")
+	}
+	first := events[0]
+	return NewEvent(first.Namespace, first.Type, first.Source, "", string(data), ""), nil
+}
@@ -6,9 +6,14 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/cloudevents/sdk-go/v2/client"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
 	"net/http"
 )
 
@@ -16,15 +21,32 @@ var (
 	GlobalCloudEventsServer = NewCloudEventServer()
 )
 
+// defaultDeliveryTimeout is how long Receive waits for busy runners before nack
+const defaultDeliveryTimeout = 10 * time.Second
+
+// CloudEventsSubscriber receives cloud events passing Match, nil Match passes all events
+type CloudEventsSubscriber struct {
+	Channel *chan event.Event
+	Match   func(cloudEvent cloudevents.Event) bool
+}
+
 type cloudEventsServer struct {
 	CTX      context.Context
 	Receiver *client.EventReceiver
+	// DeliveryTimeout bounds time of sending event to channels of runners
+	DeliveryTimeout time.Duration
+
+	mutex sync.RWMutex
 	// Channel Mapper
-	EventChannelMapper map[string]*chan event.Event
+	EventChannelMapper map[string]CloudEventsSubscriber
 }
 
 func NewCloudEventServer() *cloudEventsServer {
-	return &cloudEventsServer{CTX: context.Background(), EventChannelMapper: make(map[string]*chan event.Event)}
+	return &cloudEventsServer{
+		CTX:                context.Background(),
+		DeliveryTimeout:    defaultDeliveryTimeout,
+		EventChannelMapper: make(map[string]CloudEventsSubscriber),
+	}
 }
 
 func (c *cloudEventsServer) Run(addr string) error {
@@ -46,32 +68,65 @@ func (c *cloudEventsServer) Run(addr string) error {
 	return nil
 }
 
-func (c *cloudEventsServer) Receive(cloudEvent cloudevents.Event) {
-	// filter cloud events with register mapper
-	key := UniqueCloudEventsKey(cloudEvent.Source(), cloudEvent.Type(), cloudEvent.SpecVersion())
-	channel, ok := c.EventChannelMapper[key]
-	if ok {
-		comEvent := event.Event{
-			Source:  cloudEvent.Source(),
-			Type:    cloudEvent.Type(),
-			Version: cloudEvent.SpecVersion(),
-			Data:    string(cloudEvent.Data()),
+// Receive sends cloud event to every subscriber it matches at the same time, a busy runner does not hold
+// up the others. It acks with 202 if any of them got it within timeout, since retry by sender would repeat
+// it to them, nacks with 404 if there is none, and with 503 if all runners were too busy so that sender retries
+func (c *cloudEventsServer) Receive(ctx context.Context, cloudEvent cloudevents.Event) protocol.Result {
+	c.mutex.RLock()
+	var channels []*chan event.Event
+	for _, subscriber := range c.EventChannelMapper {
+		if subscriber.Match == nil || subscriber.Match(cloudEvent) {
+			channels = append(channels, subscriber.Channel)
 		}
-		zap.L().Info("cloud events receive ", zap.Any("event", cloudEvent))
-		*channel <- comEvent
-	} else {
+	}
+	c.mutex.RUnlock()
+	if len(channels) == 0 {
 		zap.L().Warn(fmt.Sprintf("cloud events receive but no monitor %s", cloudEvent))
+		return cehttp.NewResult(http.StatusNotFound, "%w: no sensor subscribes to source %s of type %s", protocol.ResultNACK, cloudEvent.Source(), cloudEvent.Type())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.DeliveryTimeout)
+	defer cancel()
+	var delivered int32
+	var wg sync.WaitGroup
+	for _, channel := range channels {
+		// id of cloud event is uuid, so that dedup by uuid drops events sent again
+		comEvent := event.NewEvent("", cloudEvent.Type(), cloudEvent.Source(), cloudEvent.SpecVersion(), string(cloudEvent.Data()), cloudEvent.ID())
+		comEvent.Key = cloudEvent.Source() + "/" + cloudEvent.ID()
+		wg.Add(1)
+		go func(channel *chan event.Event) {
+			defer wg.Done()
+			select {
+			case *channel <- comEvent:
+				atomic.AddInt32(&delivered, 1)
+			case <-ctx.Done():
+			}
+		}(channel)
+	}
+	wg.Wait()
+
+	if delivered == 0 {
+		return cehttp.NewResult(http.StatusServiceUnavailable, "%w: delivered to none of %d sensors: %v", protocol.ResultNACK, len(channels), ctx.Err())
+	}
+	if int(delivered) < len(channels) {
+		zap.L().Warn(fmt.Sprintf("cloud event %s is delivered to %d of %d sensors before timeout", cloudEvent.ID(), delivered, len(channels)))
 	}
+	zap.L().Debug("cloud events receive ", zap.String("id", cloudEvent.ID()), zap.Int32("sensors", delivered))
+	return cehttp.NewResult(http.StatusAccepted, "%w: delivered to %d of %d sensors", protocol.ResultACK, delivered, len(channels))
 }
 
 func UniqueCloudEventsKey(source, t, version string) string {
 	return fmt.Sprintf("%s-%s-%s", source, t, version)
 }
 
-func (c *cloudEventsServer) UpdateMonitor(key string, channel *chan event.Event) {
-	c.EventChannelMapper[key] = channel
+func (c *cloudEventsServer) UpdateMonitor(key string, subscriber CloudEventsSubscriber) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.EventChannelMapper[key] = subscriber
 }
 
 func (c *cloudEventsServer) DeleteMonitor(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	delete(c.EventChannelMapper, key)
 }
@@ -1,8 +1,18 @@
 package server
 
 import (
+	"context"
+	"eventrigger.com/operator/common/event"
 	"fmt"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_NewController(t *testing.T) {
@@ -12,3 +22,80 @@ func Test_NewController(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func Test_CloudEventsReceive(t *testing.T) {
+	c := NewCloudEventServer()
+	c.DeliveryTimeout = 50 * time.Millisecond
+	e := cloudevents.NewEvent()
+	e.SetID("1")
+	e.SetSource("/orders")
+	e.SetType("order.created")
+
+	result := c.Receive(context.Background(), e)
+	var status *cehttp.Result
+	assert.True(t, protocol.ResultAs(result, &status))
+	assert.Equal(t, http.StatusNotFound, status.StatusCode)
+	assert.True(t, protocol.IsNACK(result))
+
+	orders := make(chan event.Event, 1)
+	c.UpdateMonitor("orders", CloudEventsSubscriber{Channel: &orders, Match: func(e cloudevents.Event) bool {
+		return e.Source() == "/orders"
+	}})
+	result = c.Receive(context.Background(), e)
+	assert.True(t, protocol.ResultAs(result, &status))
+	assert.Equal(t, http.StatusAccepted, status.StatusCode)
+	assert.True(t, protocol.IsACK(result))
+	received := <-orders
+	assert.Equal(t, "1", received.UUID)
+	assert.Equal(t, "/orders/1", received.Key)
+	assert.Equal(t, "order.created", received.Type)
+
+	// runner does not take events, the others still get it and sender does not retry
+	busy := make(chan event.Event)
+	c.UpdateMonitor("busy", CloudEventsSubscriber{Channel: &busy})
+	result = c.Receive(context.Background(), e)
+	assert.True(t, protocol.ResultAs(result, &status))
+	assert.Equal(t, http.StatusAccepted, status.StatusCode)
+	assert.True(t, protocol.IsACK(result))
+	assert.Equal(t, "1", (<-orders).UUID)
+
+	// no runner takes events, sender retries
+	orders <- received
+	result = c.Receive(context.Background(), e)
+	assert.True(t, protocol.ResultAs(result, &status))
+	assert.Equal(t, http.StatusServiceUnavailable, status.StatusCode)
+	assert.False(t, protocol.IsACK(result))
+	<-orders
+
+	c.DeleteMonitor("busy")
+	c.DeleteMonitor("orders")
+	assert.Len(t, c.EventChannelMapper, 0)
+}
+
+func Test_CloudEventsReceiveHTTPStatus(t *testing.T) {
+	c := NewCloudEventServer()
+	p, err := cloudevents.NewHTTP()
+	assert.Nil(t, err)
+	c.Receiver, err = cloudevents.NewHTTPReceiveHandler(c.CTX, p, c.Receive)
+	assert.Nil(t, err)
+	s := httptest.NewServer(c.Receiver)
+	defer s.Close()
+
+	send := func() int {
+		req, _ := http.NewRequest(http.MethodPost, s.URL, strings.NewReader(`{}`))
+		req.Header.Set("ce-specversion", "1.0")
+		req.Header.Set("ce-id", "1")
+		req.Header.Set("ce-source", "/orders")
+		req.Header.Set("ce-type", "order.created")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusNotFound, send())
+	orders := make(chan event.Event, 1)
+	c.UpdateMonitor("orders", CloudEventsSubscriber{Channel: &orders})
+	assert.Equal(t, http.StatusAccepted, send())
+	assert.Equal(t, `{}`, (<-orders).Data)
+}
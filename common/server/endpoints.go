@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"eventrigger.com/operator/common/k8s"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerCoreV1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// endpointSyncTimeout is how long Watch waits for pods of namespace to be cached
+	endpointSyncTimeout = 30 * time.Second
+)
+
+var (
+	// GlobalEndpointCache resolves ready endpoints of k8s_http hosts from pod informers of their namespaces
+	GlobalEndpointCache = NewEndpointCache()
+)
+
+// Endpoint is a ready pod serving http
+type Endpoint struct {
+	Pod     string
+	Address string
+}
+
+// endpointInformer is pod informer of a namespace, shared by k8s_http triggers of the namespace
+type endpointInformer struct {
+	lister listerCoreV1.PodLister
+	refs   int
+	// syncedCh is closed once cache synced or failed to
+	syncedCh chan struct{}
+	err      error
+	stopCh   chan struct{}
+}
+
+// endpointWaiter is a request waiting for cold start, it is woken only by pods it selects
+type endpointWaiter struct {
+	namespace string
+	selector  labels.Selector
+	ch        chan struct{}
+}
+
+type endpointCache struct {
+	mutex     sync.Mutex
+	informers map[string]*endpointInformer
+	waiters   map[*endpointWaiter]struct{}
+	client    func() (kubernetes.Interface, error)
+}
+
+func NewEndpointCache() *endpointCache {
+	return &endpointCache{
+		informers: make(map[string]*endpointInformer),
+		waiters:   make(map[*endpointWaiter]struct{}),
+		client:    newKubeClient,
+	}
+}
+
+func newKubeClient() (kubernetes.Interface, error) {
+	cfg, err := k8s.GetKubeConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "get kube config")
+	}
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "new k8s cli with config")
+	}
+	return cli, nil
+}
+
+// Watch caches pods of namespace until Unwatch is called as many times, it is called by k8s_http triggers
+func (c *endpointCache) Watch(ctx context.Context, namespace string) error {
+	c.mutex.Lock()
+	inf, ok := c.informers[namespace]
+	if ok {
+		inf.refs++
+		c.mutex.Unlock()
+		<-inf.syncedCh
+		return inf.err
+	}
+	inf = &endpointInformer{refs: 1, syncedCh: make(chan struct{}), stopCh: make(chan struct{})}
+	c.informers[namespace] = inf
+	c.mutex.Unlock()
+
+	// sync outside lock, so that other namespaces are not blocked
+	inf.err = c.start(ctx, namespace, inf)
+	if inf.err != nil {
+		c.mutex.Lock()
+		// informer is stopped by Unwatch if it is not registered any more
+		if c.informers[namespace] == inf {
+			delete(c.informers, namespace)
+			close(inf.stopCh)
+		}
+		c.mutex.Unlock()
+	}
+	close(inf.syncedCh)
+	return inf.err
+}
+
+// Unwatch stops pod informer of namespace after its last trigger
+func (c *endpointCache) Unwatch(namespace string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	inf, ok := c.informers[namespace]
+	if !ok {
+		return
+	}
+	inf.refs--
+	if inf.refs > 0 {
+		return
+	}
+	delete(c.informers, namespace)
+	close(inf.stopCh)
+	zap.L().Info(fmt.Sprintf("endpoint cache of namespace %s stopped", namespace))
+}
+
+func (c *endpointCache) start(ctx context.Context, namespace string, inf *endpointInformer) error {
+	cli, err := c.client()
+	if err != nil {
+		return err
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(cli, 0, informers.WithNamespace(namespace))
+	informer := factory.Core().V1().Pods()
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.notify(obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) { c.notify(oldObj, newObj) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			c.notify(obj)
+		},
+	})
+	inf.lister = informer.Lister()
+	factory.Start(inf.stopCh)
+
+	ctx, cancel := context.WithTimeout(ctx, endpointSyncTimeout)
+	defer cancel()
+	if ok := cache.WaitForNamedCacheSync("endpoints", ctx.Done(), informer.Informer().HasSynced); !ok {
+		return errors.New(fmt.Sprintf("failed to wait for endpoint caches of namespace %s to sync", namespace))
+	}
+	zap.L().Info(fmt.Sprintf("endpoint cache of namespace %s started", namespace))
+	return nil
+}
+
+// notify wakes up waiters selecting changed pods
+func (c *endpointCache) notify(objs ...interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, obj := range objs {
+		p, ok := obj.(*v1.Pod)
+		if !ok {
+			continue
+		}
+		for w := range c.waiters {
+			if w.namespace == p.Namespace && w.selector.Matches(labels.Set(p.Labels)) {
+				close(w.ch)
+				delete(c.waiters, w)
+			}
+		}
+	}
+}
+
+func (c *endpointCache) wait(namespace string, selector labels.Selector) *endpointWaiter {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	w := &endpointWaiter{namespace: namespace, selector: selector, ch: make(chan struct{})}
+	c.waiters[w] = struct{}{}
+	return w
+}
+
+func (c *endpointCache) cancelWait(w *endpointWaiter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.waiters, w)
+}
+
+// ReadyEndpoints lists endpoints of ready pods selected by selector from cache, ordered by pod name
+func (c *endpointCache) ReadyEndpoints(namespace string, selector labels.Selector) ([]Endpoint, error) {
+	c.mutex.Lock()
+	inf, ok := c.informers[namespace]
+	c.mutex.Unlock()
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("pods of namespace %s are not watched", namespace))
+	}
+	<-inf.syncedCh
+	if inf.err != nil {
+		return nil, inf.err
+	}
+	pods, err := inf.lister.Pods(namespace).List(selector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list pods with labels %s", selector)
+	}
+	endpoints := make([]Endpoint, 0, len(pods))
+	for _, p := range pods {
+		if address, ok := podAddress(p); ok {
+			endpoints = append(endpoints, Endpoint{Pod: p.Name, Address: address})
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Pod < endpoints[j].Pod })
+	return endpoints, nil
+}
+
+// WaitEndpoints returns ready endpoints, it waits up to timeout while there is none, e.g. scaled from zero
+func (c *endpointCache) WaitEndpoints(ctx context.Context, namespace string, selector labels.Selector, timeout time.Duration) ([]Endpoint, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		// wait before listing, so that no change is missed in between
+		w := c.wait(namespace, selector)
+		endpoints, err := c.ReadyEndpoints(namespace, selector)
+		if err != nil || len(endpoints) > 0 {
+			c.cancelWait(w)
+			return endpoints, err
+		}
+		select {
+		case <-w.ch:
+		case <-timer.C:
+			c.cancelWait(w)
+			return nil, errors.New(fmt.Sprintf("waiting pod %s select %s to be ready timeout %s", namespace, selector, timeout))
+		case <-ctx.Done():
+			c.cancelWait(w)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// podAddress is ip:port of pod, port named http is preferred, otherwise the first container port
+func podAddress(p *v1.Pod) (string, bool) {
+	if p.DeletionTimestamp != nil || p.Status.PodIP == "" || len(p.Status.ContainerStatuses) == 0 {
+		return "", false
+	}
+	for _, sta := range p.Status.ContainerStatuses {
+		if !sta.Ready {
+			return "", false
+		}
+	}
+	var port int32
+	for _, c := range p.Spec.Containers {
+		for _, pp := range c.Ports {
+			if port == 0 {
+				port = pp.ContainerPort
+			}
+			if pp.Name == "http" {
+				port = pp.ContainerPort
+			}
+		}
+	}
+	if port == 0 {
+		return "", false
+	}
+	return fmt.Sprintf("%s:%d", p.Status.PodIP, port), true
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func TestPodAddress(t *testing.T) {
+	p := &v1.Pod{
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Ports: []v1.ContainerPort{{Name: "grpc", ContainerPort: 9090}, {Name: "http", ContainerPort: 8080}},
+		}}},
+		Status: v1.PodStatus{PodIP: "10.0.0.1", ContainerStatuses: []v1.ContainerStatus{{Ready: true}}},
+	}
+	address, ok := podAddress(p)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1:8080", address)
+
+	p.Status.ContainerStatuses[0].Ready = false
+	_, ok = podAddress(p)
+	assert.False(t, ok)
+}
+
+func readyPod(namespace, name, app string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": app}},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Ports: []v1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+		}}},
+		Status: v1.PodStatus{PodIP: "10.0.0.1", ContainerStatuses: []v1.ContainerStatus{{Ready: true}}},
+	}
+}
+
+func TestEndpointCacheWatch(t *testing.T) {
+	cli := fake.NewSimpleClientset(readyPod("default", "a-1", "a"), readyPod("other", "a-2", "a"))
+	c := NewEndpointCache()
+	c.client = func() (kubernetes.Interface, error) { return cli, nil }
+	selector := labels.SelectorFromSet(labels.Set{"app": "a"})
+
+	_, err := c.ReadyEndpoints("default", selector)
+	assert.Error(t, err)
+	assert.NoError(t, c.Watch(context.Background(), "default"))
+	assert.NoError(t, c.Watch(context.Background(), "default"))
+
+	// only pods of watched namespace are cached
+	endpoints, err := c.ReadyEndpoints("default", selector)
+	assert.NoError(t, err)
+	assert.Equal(t, []Endpoint{{Pod: "a-1", Address: "10.0.0.1:8080"}}, endpoints)
+	_, err = c.ReadyEndpoints("other", selector)
+	assert.Error(t, err)
+
+	c.Unwatch("default")
+	_, err = c.ReadyEndpoints("default", selector)
+	assert.NoError(t, err)
+	c.Unwatch("default")
+	_, err = c.ReadyEndpoints("default", selector)
+	assert.Error(t, err)
+}
+
+func TestEndpointCacheNotify(t *testing.T) {
+	c := NewEndpointCache()
+	a := c.wait("default", labels.SelectorFromSet(labels.Set{"app": "a"}))
+	b := c.wait("default", labels.SelectorFromSet(labels.Set{"app": "b"}))
+	other := c.wait("other", labels.SelectorFromSet(labels.Set{"app": "a"}))
+
+	c.notify(readyPod("default", "a-1", "a"))
+	select {
+	case <-a.ch:
+	default:
+		t.Fatal("waiter of changed pod is not woken")
+	}
+	for _, w := range []*endpointWaiter{b, other} {
+		select {
+		case <-w.ch:
+			t.Fatal("waiter of other pods is woken")
+		default:
+		}
+	}
+	assert.Len(t, c.waiters, 2)
+	c.cancelWait(b)
+	c.cancelWait(other)
+	assert.Empty(t, c.waiters)
+}
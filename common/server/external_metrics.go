@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"eventrigger.com/operator/common/k8s"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	certutil "k8s.io/client-go/util/cert"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ExternalMetricsGroupVersion = "external.metrics.k8s.io/v1beta1"
+
+	// metric label of sensor name, hpa selects sensor by matchLabels sensor=<name>
+	ExternalMetricSensorLabel = "sensor"
+
+	// metrics of sensor
+	MetricEventRate    = "eventrigger_event_rate"
+	MetricQueueDepth   = "eventrigger_queue_depth"
+	MetricKafkaLag     = "eventrigger_kafka_lag"
+	MetricHttpInFlight = "eventrigger_http_inflight"
+)
+
+var (
+	GlobalExternalMetricsServer = NewExternalMetricsServer()
+
+	externalMetricNames = []string{MetricEventRate, MetricQueueDepth, MetricKafkaLag, MetricHttpInFlight}
+)
+
+// ExternalMetricValue is external.metrics.k8s.io/v1beta1 ExternalMetricValue
+type ExternalMetricValue struct {
+	MetricName   string            `json:"metricName"`
+	MetricLabels map[string]string `json:"metricLabels"`
+	Timestamp    metav1.Time       `json:"timestamp"`
+	Value        resource.Quantity `json:"value"`
+}
+
+// ExternalMetricValueList is external.metrics.k8s.io/v1beta1 ExternalMetricValueList
+type ExternalMetricValueList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []ExternalMetricValue `json:"items"`
+}
+
+type sensorKey struct {
+	Namespace string
+	Name      string
+}
+
+type sensorMetric struct {
+	Value     resource.Quantity
+	Timestamp time.Time
+}
+
+// externalMetricsServer serves per sensor metrics by external.metrics.k8s.io api, so that standard hpa
+// can scale workloads by eventrigger metrics. It is registered by an APIService pointing to operator.
+type externalMetricsServer struct {
+	gin  *gin.Engine
+	auth metricsAuthorizer
+	// serving is set while Run is listening, so that hpa can read metrics
+	serving int32
+
+	// metric name -> sensor -> value
+	mutex   sync.RWMutex
+	metrics map[string]map[sensorKey]sensorMetric
+}
+
+func NewExternalMetricsServer() *externalMetricsServer {
+	s := &externalMetricsServer{
+		gin:     gin.New(),
+		metrics: make(map[string]map[sensorKey]sensorMetric),
+	}
+	s.gin.GET("/apis/"+ExternalMetricsGroupVersion, s.Authorize, s.DiscoveryHandler)
+	s.gin.GET("/apis/"+ExternalMetricsGroupVersion+"/namespaces/:namespace/:metric", s.Authorize, s.MetricHandler)
+	s.gin.GET("/healthz", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	return s
+}
+
+// SetMetric updates metric of sensor, value is a float like event rate per second
+func (s *externalMetricsServer) SetMetric(namespace, sensor, metric string, value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sensors, ok := s.metrics[metric]
+	if !ok {
+		sensors = make(map[sensorKey]sensorMetric)
+		s.metrics[metric] = sensors
+	}
+	sensors[sensorKey{Namespace: namespace, Name: sensor}] = sensorMetric{
+		Value:     *resource.NewMilliQuantity(int64(value*1000), resource.DecimalSI),
+		Timestamp: time.Now(),
+	}
+}
+
+// DeleteSensor removes all metrics of sensor
+func (s *externalMetricsServer) DeleteSensor(namespace, sensor string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, sensors := range s.metrics {
+		delete(sensors, sensorKey{Namespace: namespace, Name: sensor})
+	}
+}
+
+// Serving reports whether external metrics api is listening
+func (s *externalMetricsServer) Serving() bool {
+	return atomic.LoadInt32(&s.serving) == 1
+}
+
+// Authorize rejects requests which are not proxied by kube-apiserver or whose user cannot get the metric
+func (s *externalMetricsServer) Authorize(c *gin.Context) {
+	if s.auth == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, metricsStatus(http.StatusUnauthorized, metav1.StatusReasonUnauthorized,
+			"authentication is not configured"))
+		return
+	}
+	code, err := s.auth.authorize(c.Request, c.Param("namespace"), c.Param("metric"))
+	if err != nil {
+		reason := metav1.StatusReasonForbidden
+		switch code {
+		case http.StatusUnauthorized:
+			reason = metav1.StatusReasonUnauthorized
+		case http.StatusInternalServerError:
+			reason = metav1.StatusReasonInternalError
+		}
+		c.AbortWithStatusJSON(code, metricsStatus(int32(code), reason, err.Error()))
+		return
+	}
+	c.Next()
+}
+
+func metricsStatus(code int32, reason metav1.StatusReason, message string) metav1.Status {
+	return metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure, Code: code, Reason: reason,
+		Message: message,
+	}
+}
+
+func (s *externalMetricsServer) DiscoveryHandler(c *gin.Context) {
+	list := metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: ExternalMetricsGroupVersion,
+	}
+	for _, name := range externalMetricNames {
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       name,
+			Namespaced: true,
+			Kind:       "ExternalMetricValueList",
+			Verbs:      metav1.Verbs{"get"},
+		})
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (s *externalMetricsServer) MetricHandler(c *gin.Context) {
+	namespace := c.Param("namespace")
+	metric := c.Param("metric")
+	selector, err := labels.Parse(c.Query("labelSelector"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, metricsStatus(http.StatusBadRequest, metav1.StatusReasonBadRequest,
+			fmt.Sprintf("invalid labelSelector: %s", err)))
+		return
+	}
+
+	list := ExternalMetricValueList{
+		TypeMeta: metav1.TypeMeta{Kind: "ExternalMetricValueList", APIVersion: ExternalMetricsGroupVersion},
+		Items:    []ExternalMetricValue{},
+	}
+	s.mutex.RLock()
+	for key, value := range s.metrics[metric] {
+		if key.Namespace != namespace {
+			continue
+		}
+		metricLabels := map[string]string{ExternalMetricSensorLabel: key.Name}
+		if !selector.Matches(labels.Set(metricLabels)) {
+			continue
+		}
+		list.Items = append(list.Items, ExternalMetricValue{
+			MetricName:   metric,
+			MetricLabels: metricLabels,
+			Timestamp:    metav1.NewTime(value.Timestamp),
+			Value:        value.Value,
+		})
+	}
+	s.mutex.RUnlock()
+	c.JSON(http.StatusOK, list)
+}
+
+// Run serves https, a self signed certificate is generated if certFile or keyFile is empty.
+// Requests are authenticated by requestheader client ca of extension-apiserver-authentication
+// and authorized by SubjectAccessReview, like any aggregated apiserver.
+func (s *externalMetricsServer) Run(ctx context.Context, addr, certFile, keyFile string) error {
+	cfg, err := k8s.GetKubeConfig()
+	if err != nil {
+		return errors.Wrap(err, "get kube config for external metrics server")
+	}
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "new k8s cli with config")
+	}
+	auth, err := newDelegatedAuth(ctx, cli)
+	if err != nil {
+		return errors.Wrap(err, "load delegated authentication of external metrics server")
+	}
+	s.auth = auth
+
+	var cert tls.Certificate
+	if certFile != "" && keyFile != "" {
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	} else {
+		var certPEM, keyPEM []byte
+		certPEM, keyPEM, err = certutil.GenerateSelfSignedCertKey("eventrigger-external-metrics", nil, nil)
+		if err == nil {
+			cert, err = tls.X509KeyPair(certPEM, keyPEM)
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "load external metrics server certificate")
+	}
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: s.gin,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			// kubelet probes /healthz without certificate
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  auth.clientCAs,
+		},
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "listen external metrics server on %s", addr)
+	}
+	atomic.StoreInt32(&s.serving, 1)
+	defer atomic.StoreInt32(&s.serving, 0)
+	zap.L().Info("external metrics server listens on ", zap.String("addr", addr))
+	return srv.ServeTLS(ln, "", "")
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	authenticationConfigMapNamespace = "kube-system"
+	authenticationConfigMapName      = "extension-apiserver-authentication"
+
+	// authorizedTTL is how long decisions of subject access reviews are cached
+	authorizedTTL = 10 * time.Second
+)
+
+// metricsAuthorizer authenticates and authorizes request to metrics api, it returns http status on rejection
+type metricsAuthorizer interface {
+	authorize(req *http.Request, namespace, metric string) (int, error)
+}
+
+type authorizedEntry struct {
+	allowed bool
+	expire  time.Time
+}
+
+// delegatedAuth trusts users asserted by kube-apiserver in request headers, just like aggregated apiservers do.
+// The apiserver proves itself by client certificate signed by requestheader client ca, and the user is
+// authorized by SubjectAccessReview.
+type delegatedAuth struct {
+	clientCAs       *x509.CertPool
+	allowedNames    []string
+	usernameHeaders []string
+	groupHeaders    []string
+	extraPrefixes   []string
+
+	cli        kubernetes.Interface
+	mutex      sync.Mutex
+	authorized map[string]authorizedEntry
+}
+
+// newDelegatedAuth loads requestheader options from extension-apiserver-authentication config map
+func newDelegatedAuth(ctx context.Context, cli kubernetes.Interface) (*delegatedAuth, error) {
+	cm, err := cli.CoreV1().ConfigMaps(authenticationConfigMapNamespace).Get(ctx, authenticationConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "get config map %s/%s", authenticationConfigMapNamespace, authenticationConfigMapName)
+	}
+	a := &delegatedAuth{
+		clientCAs:  x509.NewCertPool(),
+		cli:        cli,
+		authorized: make(map[string]authorizedEntry),
+	}
+	if !a.clientCAs.AppendCertsFromPEM([]byte(cm.Data["requestheader-client-ca-file"])) {
+		return nil, errors.New("requestheader-client-ca-file of extension-apiserver-authentication has no certificate")
+	}
+	for key, value := range map[string]*[]string{
+		"requestheader-allowed-names":        &a.allowedNames,
+		"requestheader-username-headers":     &a.usernameHeaders,
+		"requestheader-group-headers":        &a.groupHeaders,
+		"requestheader-extra-headers-prefix": &a.extraPrefixes,
+	} {
+		if cm.Data[key] == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(cm.Data[key]), value); err != nil {
+			return nil, errors.Wrapf(err, "parse %s of extension-apiserver-authentication", key)
+		}
+	}
+	if len(a.usernameHeaders) == 0 {
+		return nil, errors.New("requestheader-username-headers of extension-apiserver-authentication is empty")
+	}
+	return a, nil
+}
+
+func (a *delegatedAuth) authorize(req *http.Request, namespace, metric string) (int, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return http.StatusUnauthorized, errors.New("client certificate of requestheader client ca is required")
+	}
+	if len(a.allowedNames) > 0 && !containsName(a.allowedNames, req.TLS.PeerCertificates[0].Subject.CommonName) {
+		return http.StatusUnauthorized, errors.New(fmt.Sprintf("client certificate %s is not allowed", req.TLS.PeerCertificates[0].Subject.CommonName))
+	}
+	var user string
+	for _, h := range a.usernameHeaders {
+		if user = req.Header.Get(h); user != "" {
+			break
+		}
+	}
+	if user == "" {
+		return http.StatusUnauthorized, errors.New("user is not asserted by request headers")
+	}
+	var groups []string
+	for _, h := range a.groupHeaders {
+		groups = append(groups, req.Header.Values(h)...)
+	}
+	extra := map[string]authorizationv1.ExtraValue{}
+	for name, values := range req.Header {
+		for _, prefix := range a.extraPrefixes {
+			if strings.HasPrefix(strings.ToLower(name), strings.ToLower(prefix)) {
+				key, err := url.PathUnescape(strings.ToLower(name[len(prefix):]))
+				if err == nil {
+					extra[key] = append(extra[key], values...)
+				}
+			}
+		}
+	}
+
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{User: user, Groups: groups, Extra: extra},
+	}
+	if metric == "" {
+		review.Spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{Path: req.URL.Path, Verb: "get"}
+	} else {
+		review.Spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+			Namespace: namespace,
+			Verb:      "get",
+			Group:     "external.metrics.k8s.io",
+			Version:   "v1beta1",
+			Resource:  metric,
+		}
+	}
+	allowed, err := a.review(req.Context(), review)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !allowed {
+		return http.StatusForbidden, errors.New(fmt.Sprintf("user %s cannot get %s in namespace %s", user, metric, namespace))
+	}
+	return 0, nil
+}
+
+// review creates SubjectAccessReview, decisions are cached for a short time since hpa polls metrics
+func (a *delegatedAuth) review(ctx context.Context, review *authorizationv1.SubjectAccessReview) (bool, error) {
+	spec := review.Spec
+	groups := append([]string{}, spec.Groups...)
+	sort.Strings(groups)
+	key := fmt.Sprintf("%s|%s|%+v|%+v", spec.User, strings.Join(groups, ","), spec.ResourceAttributes, spec.NonResourceAttributes)
+
+	now := time.Now()
+	a.mutex.Lock()
+	entry, ok := a.authorized[key]
+	a.mutex.Unlock()
+	if ok && now.Before(entry.expire) {
+		return entry.allowed, nil
+	}
+
+	result, err := a.cli.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, errors.Wrap(err, "create subject access review")
+	}
+	a.mutex.Lock()
+	for k, e := range a.authorized {
+		if now.After(e.expire) {
+			delete(a.authorized, k)
+		}
+	}
+	a.authorized[key] = authorizedEntry{allowed: result.Status.Allowed, expire: now.Add(authorizedTTL)}
+	a.mutex.Unlock()
+	return result.Status.Allowed, nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
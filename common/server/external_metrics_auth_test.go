@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	certutil "k8s.io/client-go/util/cert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExternalMetricsDelegatedAuth(t *testing.T) {
+	certPEM, _, err := certutil.GenerateSelfSignedCertKey("front-proxy-client", nil, nil)
+	assert.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+
+	cli := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: authenticationConfigMapNamespace, Name: authenticationConfigMapName},
+		Data: map[string]string{
+			"requestheader-client-ca-file":   string(certPEM),
+			"requestheader-allowed-names":    `["` + cert.Subject.CommonName + `"]`,
+			"requestheader-username-headers": `["X-Remote-User"]`,
+			"requestheader-group-headers":    `["X-Remote-Group"]`,
+		},
+	})
+	reviews := 0
+	cli.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = review.Spec.User == "system:serviceaccount:kube-system:horizontal-pod-autoscaler" &&
+			attrs != nil && attrs.Resource == MetricEventRate && attrs.Namespace == "default"
+		return true, review, nil
+	})
+	auth, err := newDelegatedAuth(context.Background(), cli)
+	assert.NoError(t, err)
+
+	s := NewExternalMetricsServer()
+	s.auth = auth
+	s.SetMetric("default", "a", MetricEventRate, 1)
+	request := func(path, user string, verified bool) int {
+		req := httptest.NewRequest(http.MethodGet, "/apis/"+ExternalMetricsGroupVersion+path, nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		if verified {
+			req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+		if user != "" {
+			req.Header.Set("X-Remote-User", user)
+		}
+		w := httptest.NewRecorder()
+		s.gin.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	hpa := "system:serviceaccount:kube-system:horizontal-pod-autoscaler"
+	assert.Equal(t, http.StatusOK, request("/namespaces/default/"+MetricEventRate, hpa, true))
+	// decision is cached
+	assert.Equal(t, http.StatusOK, request("/namespaces/default/"+MetricEventRate, hpa, true))
+	assert.Equal(t, 1, reviews)
+	assert.Equal(t, http.StatusForbidden, request("/namespaces/other/"+MetricEventRate, hpa, true))
+	assert.Equal(t, http.StatusForbidden, request("/namespaces/default/"+MetricEventRate, "alice", true))
+	assert.Equal(t, http.StatusUnauthorized, request("/namespaces/default/"+MetricEventRate, hpa, false))
+	assert.Equal(t, http.StatusUnauthorized, request("/namespaces/default/"+MetricEventRate, "", true))
+
+	// without authentication nothing is served
+	s.auth = nil
+	assert.Equal(t, http.StatusUnauthorized, request("/namespaces/default/"+MetricEventRate, hpa, true))
+}
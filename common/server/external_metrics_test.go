@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type allowAll struct{}
+
+func (allowAll) authorize(*http.Request, string, string) (int, error) {
+	return 0, nil
+}
+
+func TestExternalMetricsHandler(t *testing.T) {
+	s := NewExternalMetricsServer()
+	s.auth = allowAll{}
+	s.SetMetric("default", "a", MetricEventRate, 1.5)
+	s.SetMetric("default", "b", MetricEventRate, 2)
+	s.SetMetric("other", "a", MetricEventRate, 3)
+
+	path := "/apis/" + ExternalMetricsGroupVersion + "/namespaces/default/" + MetricEventRate +
+		"?labelSelector=" + url.QueryEscape("sensor=a")
+	w := httptest.NewRecorder()
+	s.gin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var list ExternalMetricValueList
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Items, 1) {
+		assert.Equal(t, "1500m", list.Items[0].Value.String())
+		assert.Equal(t, "a", list.Items[0].MetricLabels[ExternalMetricSensorLabel])
+	}
+
+	s.DeleteSensor("default", "a")
+	w = httptest.NewRecorder()
+	s.gin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Empty(t, list.Items)
+}
@@ -1,198 +1,211 @@
 package server
 
 import (
+	"encoding/json"
 	cEvent "eventrigger.com/operator/common/event"
 	"eventrigger.com/operator/common/k8s"
 	"fmt"
 	"github.com/pkg/errors"
-	"github.com/viney-shih/go-lock"
 	"go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/kubernetes"
-	listerCoreV1 "k8s.io/client-go/listers/core/v1"
-	"k8s.io/client-go/util/workqueue"
-	"k8s.io/klog/v2"
-	"time"
-
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/informers"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"sync"
+	"time"
 )
 
 var (
-	GlobalK8sEventsMonitor *k8sEventsMonitor
+	// GlobalK8sEventsMonitor runs informers of core/v1 events only while k8s_events triggers subscribe to them
+	GlobalK8sEventsMonitor = NewK8sEventsMonitor()
 )
 
-type k8sEventsMonitor struct {
-	Cfg       *rest.Config
-	ClientSet *kubernetes.Clientset
-
-	InformerFactory      informers.SharedInformerFactory
-	EventsLister         listerCoreV1.EventLister
-	EventsSynced         cache.InformerSynced
-	Workqueue            workqueue.RateLimitingInterface
-	EventInformerCacheRW *lock.CASMutex
-
-	EventChannelMapper map[string]*chan cEvent.Event
-	StopChan           chan struct{}
+// K8sEventsSubscriber receives events passing Match, nil Match passes all events
+type K8sEventsSubscriber struct {
+	Channel *chan cEvent.Event
+	Match   func(event *v1.Event) bool
+	// Namespace scopes informer of subscriber, empty means all namespaces
+	Namespace string
+	// Type and Reason are pushed down to api server as field selector if not empty
+	Type   string
+	Reason string
 }
 
-func NewK8sEventsMonitor() (monitor *k8sEventsMonitor, err error) {
-	c := &k8sEventsMonitor{
-		Workqueue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "k8sEvents"),
-		EventInformerCacheRW: lock.NewCASMutex(),
-		EventChannelMapper:   make(map[string]*chan cEvent.Event),
-		StopChan:             make(chan struct{}),
+// scope returns namespace and field selector of informer the subscriber needs
+func (s K8sEventsSubscriber) scope() eventsScope {
+	set := fields.Set{}
+	if s.Type != "" {
+		set["type"] = s.Type
 	}
-	cfg, err := k8s.GetKubeConfig()
-	if err != nil {
-		return nil, err
-	}
-	c.Cfg = cfg
-	c.ClientSet, err = kubernetes.NewForConfig(c.Cfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "new for k8s config")
+	if s.Reason != "" {
+		set["reason"] = s.Reason
 	}
+	return eventsScope{Namespace: s.Namespace, FieldSelector: fields.SelectorFromSet(set).String()}
+}
 
-	c.InformerFactory = informers.NewSharedInformerFactory(c.ClientSet, 0)
-	informer := c.InformerFactory.Core().V1().Events()
-	c.EventsLister = informer.Lister()
-	c.EventsSynced = informer.Informer().HasSynced
-	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			event, ok := obj.(*v1.Event)
-			if !ok {
-				zap.L().Error("failed")
-			}
-			key := UniqueK8sEventKey(event.Kind, event.Type, event.APIVersion, event.Namespace)
-			channel, ok := c.EventChannelMapper[key]
-			if ok {
-				ce := cEvent.Event{
-					Namespace: event.Namespace,
-					Source:    event.Source.String(),
-					Type:      event.Type,
-					Version:   event.APIVersion,
-					Data:      event.Message,
-				}
-				*channel <- ce
-			}
-		},
-	})
-	return c, nil
+type eventsScope struct {
+	Namespace     string
+	FieldSelector string
 }
 
-func (c *k8sEventsMonitor) Run() error {
-	c.InformerFactory.Start(c.StopChan)
-	defer runtime.HandleCrash()
-	defer c.Workqueue.ShutDown()
+type eventsInformer struct {
+	subscribers map[string]K8sEventsSubscriber
+	startTime   time.Time
+	synced      cache.InformerSynced
+	stopCh      chan struct{}
+}
 
-	zap.L().Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForNamedCacheSync("k8sEvents", c.StopChan, c.EventsSynced); !ok {
-		return fmt.Errorf("failed to wait for caches to sync")
-	}
+// k8sEventsMonitor shares one informer among subscribers of same namespace and field selector,
+// an informer is started by its first subscriber and stopped after its last subscriber is deleted
+type k8sEventsMonitor struct {
+	mutex     sync.Mutex
+	ClientSet kubernetes.Interface
+	informers map[eventsScope]*eventsInformer
+	// scopes are scopes of subscribers by key
+	scopes map[string]eventsScope
+}
 
-	zap.L().Info("Starting event workers")
-	// Launch two workers to process Foo resources
-	for i := 0; i < 5; i++ {
-		go wait.Until(c.runWorker, time.Second, c.StopChan)
+func NewK8sEventsMonitor() *k8sEventsMonitor {
+	return &k8sEventsMonitor{
+		informers: make(map[eventsScope]*eventsInformer),
+		scopes:    make(map[string]eventsScope),
 	}
+}
 
-	klog.Info("Started event workers")
-	<-c.StopChan
-	klog.Info("Shutting down event workers")
-
-	return nil
+func UniqueK8sEventKey(eventKind, eventType, eventAPIVersion, namespace string) string {
+	return fmt.Sprintf("%s%s-%s-%s", eventKind, eventType, eventAPIVersion, namespace)
 }
 
-func (c *k8sEventsMonitor) runWorker() {
-	for c.processNextWorkItem() {
+// UpdateMonitor adds or replaces subscriber of key, informer of its scope is started if there is none
+func (c *k8sEventsMonitor) UpdateMonitor(key string, subscriber K8sEventsSubscriber) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.deleteLocked(key)
+
+	scope := subscriber.scope()
+	inf, ok := c.informers[scope]
+	if !ok {
+		var err error
+		if inf, err = c.startInformer(scope); err != nil {
+			return err
+		}
+		c.informers[scope] = inf
 	}
+	inf.subscribers[key] = subscriber
+	c.scopes[key] = scope
+	return nil
 }
 
-func (c *k8sEventsMonitor) processNextWorkItem() bool {
-	obj, shutdown := c.Workqueue.Get()
+func (c *k8sEventsMonitor) DeleteMonitor(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.deleteLocked(key)
+}
 
-	if shutdown {
-		return false
+func (c *k8sEventsMonitor) deleteLocked(key string) {
+	scope, ok := c.scopes[key]
+	if !ok {
+		return
 	}
+	delete(c.scopes, key)
+	inf := c.informers[scope]
+	delete(inf.subscribers, key)
+	if len(inf.subscribers) == 0 {
+		close(inf.stopCh)
+		delete(c.informers, scope)
+		zap.L().Info(fmt.Sprintf("k8s events informer of namespace %q and fields %q stopped", scope.Namespace, scope.FieldSelector))
+	}
+}
 
-	// We wrap this block in a func so we can defer c.workqueue.Done.
-	err := func(obj interface{}) error {
-		// We call Done here so the workqueue knows we have finished
-		// processing this item. We also must remember to call Forget if we
-		// do not want this work item being re-queued. For example, we do
-		// not call Forget if a transient error occurs, instead the item is
-		// put back on the workqueue and attempted again after a back-off
-		// period.
-		defer c.Workqueue.Done(obj)
-		var key string
-		var ok bool
-
-		if key, ok = obj.(string); !ok {
-			// As the item in the workqueue is actually invalid, we call
-			// Forget here else we'd go into a loop of attempting to
-			// process a work item that is invalid.
-			c.Workqueue.Forget(obj)
-			runtime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
-			return nil
+func (c *k8sEventsMonitor) startInformer(scope eventsScope) (*eventsInformer, error) {
+	if c.ClientSet == nil {
+		cfg, err := k8s.GetKubeConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "get kube config for k8s events")
 		}
-		// Run the syncHandler, passing it the namespace/name string of the
-		// Foo resource to be synced.
-		if err := c.syncHandler(key); err != nil {
-			// Put the item back on the workqueue to handle any transient errors.
-			c.Workqueue.AddRateLimited(key)
-			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+		c.ClientSet, err = kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "new for k8s config")
 		}
-		// Finally, if no error occurs we Forget this item so it does not
-		// get queued again until another change happens.
-		c.Workqueue.Forget(obj)
-		klog.Infof("Successfully synced '%s'", key)
-		return nil
-	}(obj)
-
-	if err != nil {
-		runtime.HandleError(err)
-		return true
 	}
-
-	return true
+	inf := &eventsInformer{
+		subscribers: make(map[string]K8sEventsSubscriber),
+		startTime:   time.Now(),
+		stopCh:      make(chan struct{}),
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(c.ClientSet, 0,
+		informers.WithNamespace(scope.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = scope.FieldSelector
+		}))
+	informer := factory.Core().V1().Events().Informer()
+	inf.synced = informer.HasSynced
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			event, ok := obj.(*v1.Event)
+			// initial list replays events happened before informer started
+			if ok && !lastTimestamp(event).Before(inf.startTime.Truncate(time.Second)) {
+				c.dispatch(inf, event)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// series of event are updates with count increased
+			oldEvent, ok := oldObj.(*v1.Event)
+			if !ok {
+				return
+			}
+			event, ok := newObj.(*v1.Event)
+			if ok && event.ResourceVersion != oldEvent.ResourceVersion {
+				c.dispatch(inf, event)
+			}
+		},
+	})
+	factory.Start(inf.stopCh)
+	zap.L().Info(fmt.Sprintf("k8s events informer of namespace %q and fields %q started", scope.Namespace, scope.FieldSelector))
+	return inf, nil
 }
 
-func (c *k8sEventsMonitor) syncHandler(key string) error {
-	// Convert the namespace/name string into a distinct namespace and name
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		runtime.HandleError(fmt.Errorf("invalid resource key: %s", key))
-		return nil
+// lastTimestamp returns time event happened last, which is set by different fields of old and new reporters
+func lastTimestamp(event *v1.Event) time.Time {
+	t := event.LastTimestamp.Time
+	if event.Series != nil && event.Series.LastObservedTime.After(t) {
+		t = event.Series.LastObservedTime.Time
 	}
-
-	// Get the Foo resource with this namespace/name
-	_, err = c.EventsLister.Events(namespace).Get(name)
-	if err != nil {
-		// The Foo resource may no longer exist, in which case we stop
-		// processing.
-		if apierrors.IsNotFound(err) {
-			runtime.HandleError(fmt.Errorf("event '%s' in work queue no longer exists", key))
-			return nil
-		}
-
-		return err
+	if event.EventTime.After(t) {
+		t = event.EventTime.Time
 	}
-
-	return nil
-}
-
-func UniqueK8sEventKey(eventKind, eventType, eventAPIVersion, namespace string) string {
-	return fmt.Sprintf("%s%s-%s-%s", eventKind, eventType, eventAPIVersion, namespace)
+	if t.IsZero() {
+		t = event.CreationTimestamp.Time
+	}
+	return t
 }
 
-func (c *k8sEventsMonitor) UpdateMonitor(key string, channel *chan cEvent.Event) {
-	c.EventChannelMapper[key] = channel
-}
+// dispatch sends the whole event as json to subscribers of informer it matches
+func (c *k8sEventsMonitor) dispatch(inf *eventsInformer, event *v1.Event) {
+	c.mutex.Lock()
+	var channels []*chan cEvent.Event
+	for _, subscriber := range inf.subscribers {
+		if subscriber.Match == nil || subscriber.Match(event) {
+			channels = append(channels, subscriber.Channel)
+		}
+	}
+	c.mutex.Unlock()
+	if len(channels) == 0 {
+		return
+	}
 
-func (c *k8sEventsMonitor) DeleteMonitor(key string) {
-	delete(c.EventChannelMapper, key)
+	data, err := json.Marshal(event)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("marshal event %s/%s: %v", event.Namespace, event.Name, err))
+		return
+	}
+	source := fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name)
+	for _, channel := range channels {
+		ce := cEvent.NewEvent(event.Namespace, event.Type, source, "", string(data), "")
+		// count is in key so that dedup by message drops redelivered events but not a series
+		ce.Key = fmt.Sprintf("%s/%d", event.UID, event.Count)
+		*channel <- ce
+	}
 }
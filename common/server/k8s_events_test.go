@@ -1,16 +1,103 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	cEvent "eventrigger.com/operator/common/event"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 	"testing"
+	"time"
 )
 
-func Test_NewEventController(t *testing.T) {
-	monitor, err := NewK8sEventsMonitor()
-	if err != nil {
-		t.Fatal(err)
+func Test_K8sEventsMonitorScopes(t *testing.T) {
+	c := NewK8sEventsMonitor()
+	c.ClientSet = fake.NewSimpleClientset()
+	channel := make(chan cEvent.Event, 1)
+
+	assert.Nil(t, c.UpdateMonitor("a", K8sEventsSubscriber{Channel: &channel, Namespace: "default", Type: v1.EventTypeWarning}))
+	assert.Nil(t, c.UpdateMonitor("b", K8sEventsSubscriber{Channel: &channel, Namespace: "default", Type: v1.EventTypeWarning}))
+	assert.Nil(t, c.UpdateMonitor("c", K8sEventsSubscriber{Channel: &channel, Reason: "BackOff"}))
+	assert.Len(t, c.informers, 2)
+	assert.Contains(t, c.informers, eventsScope{Namespace: "default", FieldSelector: "type=Warning"})
+	assert.Contains(t, c.informers, eventsScope{FieldSelector: "reason=BackOff"})
+
+	// replaced subscriber moves to informer of its new scope
+	assert.Nil(t, c.UpdateMonitor("b", K8sEventsSubscriber{Channel: &channel, Reason: "BackOff"}))
+	assert.Len(t, c.informers, 2)
+	c.DeleteMonitor("a")
+	assert.Len(t, c.informers, 1)
+	c.DeleteMonitor("b")
+	c.DeleteMonitor("c")
+	c.DeleteMonitor("c")
+	assert.Len(t, c.informers, 0)
+	assert.Len(t, c.scopes, 0)
+}
+
+func Test_K8sEventsDispatch(t *testing.T) {
+	cli := fake.NewSimpleClientset()
+	// fake clientset drops events created before watch starts
+	watching := make(chan struct{})
+	cli.PrependWatchReactor("events", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := cli.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		if err == nil {
+			close(watching)
+		}
+		return true, w, err
+	})
+	c := NewK8sEventsMonitor()
+	c.ClientSet = cli
+	warnings := make(chan cEvent.Event, 1)
+	all := make(chan cEvent.Event, 2)
+	assert.Nil(t, c.UpdateMonitor("warnings", K8sEventsSubscriber{Channel: &warnings, Match: func(e *v1.Event) bool {
+		return e.Type == v1.EventTypeWarning
+	}}))
+	assert.Nil(t, c.UpdateMonitor("all", K8sEventsSubscriber{Channel: &all}))
+	defer c.DeleteMonitor("warnings")
+
+	e := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "app.1", Namespace: "default", UID: "u1"},
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "app"},
+		Type:           v1.EventTypeNormal,
+		Reason:         "Pulled",
+		Count:          1,
+		LastTimestamp:  metav1.Now(),
 	}
-	err = monitor.Run()
-	if err != nil {
-		t.Fatal(err)
+	// wait until informer watches, otherwise event is replayed by list and taken as old one
+	assert.True(t, cache.WaitForCacheSync(c.informers[eventsScope{}].stopCh, c.informers[eventsScope{}].synced))
+	select {
+	case <-watching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("informer does not watch")
 	}
+	_, err := cli.CoreV1().Events("default").Create(context.Background(), e, metav1.CreateOptions{})
+	assert.Nil(t, err)
+
+	var ce cEvent.Event
+	select {
+	case ce = <-all:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event is not dispatched")
+	}
+	assert.Len(t, warnings, 0)
+	assert.Equal(t, "Pod/app", ce.Source)
+	assert.Equal(t, "u1/1", ce.Key)
+	var data v1.Event
+	assert.Nil(t, json.Unmarshal([]byte(ce.Data), &data))
+	assert.Equal(t, "Pulled", data.Reason)
+
+	c.DeleteMonitor("all")
+	e.Type = v1.EventTypeWarning
+	c.dispatch(c.informers[eventsScope{}], e)
+	assert.Len(t, warnings, 1)
+	assert.Len(t, all, 0)
+
+	// events happened before informer started are skipped
+	e.LastTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	assert.True(t, lastTimestamp(e).Before(c.informers[eventsScope{}].startTime))
 }
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerCoreV1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"sync"
+	"time"
+)
+
+const (
+	// secretSyncTimeout is how long Start waits for secrets to be listed
+	secretSyncTimeout = 30 * time.Second
+)
+
+var (
+	// GlobalSecretCache serves secrets of tls certificates and trigger credentials from secret informers of
+	// namespaces of sensors, so that updated secrets take effect without restarting sensors
+	GlobalSecretCache = NewSecretCache()
+
+	// errSecretsNotSynced is returned by lookups before secrets of namespace are cached, they never wait
+	// for sync since tls handshakes look secrets up
+	errSecretsNotSynced = errors.New("secrets are not synced")
+)
+
+// secretInformer is secret informer of a namespace, shared by sensors of the namespace
+type secretInformer struct {
+	refs int
+	// lister, synced and stop are set once informer is started
+	lister listerCoreV1.SecretLister
+	synced cache.InformerSynced
+	stop   context.CancelFunc
+}
+
+type secretCache struct {
+	mutex     sync.Mutex
+	informers map[string]*secretInformer
+	client    func() (kubernetes.Interface, error)
+	// cli and ctx are set by Start, informers are stopped once ctx is done
+	cli kubernetes.Interface
+	ctx context.Context
+}
+
+func NewSecretCache() *secretCache {
+	return &secretCache{
+		informers: make(map[string]*secretInformer),
+		client:    newKubeClient,
+	}
+}
+
+// Start is called by operator before serving, it fails if secrets cannot be read.
+// Informers of namespaces watched before are started too.
+func (c *secretCache) Start(ctx context.Context) error {
+	cli, err := c.client()
+	if err != nil {
+		return err
+	}
+	listCtx, cancel := context.WithTimeout(ctx, secretSyncTimeout)
+	defer cancel()
+	if _, err := cli.CoreV1().Secrets(metav1.NamespaceAll).List(listCtx, metav1.ListOptions{Limit: 1}); err != nil {
+		return errors.Wrap(err, "list secrets for secret cache")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cli = cli
+	c.ctx = ctx
+	for namespace, inf := range c.informers {
+		c.startLocked(namespace, inf)
+	}
+	zap.L().Info("secret cache started")
+	return nil
+}
+
+// Watch caches secrets of namespace until Unwatch is called as many times, it is called for each sensor
+// of namespace. Secrets are synced in background.
+func (c *secretCache) Watch(namespace string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	inf, ok := c.informers[namespace]
+	if ok {
+		inf.refs++
+		return
+	}
+	inf = &secretInformer{refs: 1}
+	c.informers[namespace] = inf
+	if c.cli != nil {
+		c.startLocked(namespace, inf)
+	}
+}
+
+// Unwatch stops secret informer of namespace after its last sensor
+func (c *secretCache) Unwatch(namespace string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	inf, ok := c.informers[namespace]
+	if !ok {
+		return
+	}
+	inf.refs--
+	if inf.refs > 0 {
+		return
+	}
+	delete(c.informers, namespace)
+	if inf.stop != nil {
+		inf.stop()
+	}
+	zap.L().Info(fmt.Sprintf("secret cache of namespace %s stopped", namespace))
+}
+
+// startLocked starts informer without waiting for sync, caller should hold the mutex
+func (c *secretCache) startLocked(namespace string, inf *secretInformer) {
+	ctx, stop := context.WithCancel(c.ctx)
+	factory := informers.NewSharedInformerFactoryWithOptions(c.cli, 0, informers.WithNamespace(namespace))
+	informer := factory.Core().V1().Secrets()
+	inf.lister = informer.Lister()
+	inf.synced = informer.Informer().HasSynced
+	inf.stop = stop
+	factory.Start(ctx.Done())
+	zap.L().Info(fmt.Sprintf("secret cache of namespace %s started", namespace))
+}
+
+// Get returns secret from cache, errSecretsNotSynced is returned until secrets of namespace are synced
+func (c *secretCache) Get(namespace, name string) (*v1.Secret, error) {
+	c.mutex.Lock()
+	inf, ok := c.informers[namespace]
+	var lister listerCoreV1.SecretLister
+	var synced cache.InformerSynced
+	if ok {
+		lister, synced = inf.lister, inf.synced
+	}
+	c.mutex.Unlock()
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("secrets of namespace %s are not watched", namespace))
+	}
+	if synced == nil || !synced() {
+		return nil, errors.Wrapf(errSecretsNotSynced, "get secret %s/%s", namespace, name)
+	}
+	s, err := lister.Secrets(namespace).Get(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get secret %s/%s", namespace, name)
+	}
+	return s, nil
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func TestSecretCacheNamespaces(t *testing.T) {
+	cli := fake.NewSimpleClientset(
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "tls"}},
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "token"}},
+	)
+	c := NewSecretCache()
+	c.client = func() (kubernetes.Interface, error) { return cli, nil }
+	// namespaces of sensors added before start are synced once started
+	c.Watch("app")
+	_, err := c.Get("app", "tls")
+	assert.Equal(t, errSecretsNotSynced, errors.Cause(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, c.Start(ctx))
+	assert.Eventually(t, func() bool {
+		_, err := c.Get("app", "tls")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = c.Get("app", "token")
+	assert.Error(t, err)
+	_, err = c.Get("kube-system", "token")
+	assert.Error(t, err)
+	assert.Len(t, c.informers, 1)
+
+	// informer is stopped after last sensor of namespace
+	c.Watch("app")
+	c.Unwatch("app")
+	assert.Contains(t, c.informers, "app")
+	c.Unwatch("app")
+	assert.NotContains(t, c.informers, "app")
+	_, err = c.Get("app", "tls")
+	assert.Error(t, err)
+}
@@ -3,20 +3,30 @@ package server
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 var (
 	GlobalHttpServer = NewHttpServer()
 )
 
+// HttpServer dispatches requests of every path and method to handlers by rules, matched in order of
+// exact host, wildcard host like *.example.com, longest path prefix and header
 type HttpServer struct {
-	gin                 *gin.Engine
-	hostHandlerMapper   map[string]Handler
-	headerHandlerMapper map[string]Handler
+	gin                       *gin.Engine
+	mutex                     sync.RWMutex
+	hostHandlerMapper         map[string]Handler
+	wildcardHostHandlerMapper map[string]Handler
+	pathPrefixHandlerMapper   map[string]Handler
+	headerHandlerMapper       map[string]Handler
+	// tls of hosts served by RunTLS
+	tls *tlsStore
 }
 
 type HttpResponse struct {
@@ -29,71 +39,139 @@ type Handler func(ctx *gin.Context) (int, interface{}, error)
 
 func NewHttpServer() (server *HttpServer) {
 	server = &HttpServer{
-		gin:                 gin.New(),
-		hostHandlerMapper:   make(map[string]Handler),
-		headerHandlerMapper: make(map[string]Handler),
+		gin:                       gin.New(),
+		hostHandlerMapper:         make(map[string]Handler),
+		wildcardHostHandlerMapper: make(map[string]Handler),
+		pathPrefixHandlerMapper:   make(map[string]Handler),
+		headerHandlerMapper:       make(map[string]Handler),
+		tls:                       newTLSStore(),
 	}
 	server.Init()
 	return server
 }
 
 func (s *HttpServer) Init() {
-	s.gin.Handle(http.MethodGet, "/", s.CommonDispatchHandler)
-	s.gin.Handle(http.MethodDelete, "/", s.CommonDispatchHandler)
-	s.gin.Handle(http.MethodPut, "/", s.CommonDispatchHandler)
-	s.gin.Handle(http.MethodPost, "/", s.CommonDispatchHandler)
+	// requests of every path and method are dispatched by rules, probes of operator are served by health port
+	s.gin.NoRoute(s.CommonDispatchHandler)
 }
 
 func (s *HttpServer) CommonDispatchHandler(c *gin.Context) {
-	if handler, ok := s.hostHandlerMapper[c.Request.Host]; ok {
-		zap.L().Info(fmt.Sprintf("match host: %s, handler %v", c.Request.Host, handler))
-		var data interface{}
-		code := 0
-		err := errors.New("")
-		code, data, err = handler(c)
-		zap.L().Info(fmt.Sprintf("request proxy of host: %s done, data %+v, code %d, err %+v",
-			c.Request.Host, data, code, err))
-		if err != nil {
-			msg := HttpResponse{Msg: err.Error()}
-			c.JSON(code, msg)
-			return
-		}
-		if code == 0 {
-			code = http.StatusOK
-		}
-		if data != nil {
-			c.JSON(code, data)
-			return
+	handler, rule, ok := s.match(c.Request)
+	if !ok {
+		c.JSON(http.StatusNotFound, HttpResponse{Code: http.StatusNotFound, Msg: fmt.Sprintf("no rule matches host %s", c.Request.Host)})
+		return
+	}
+	zap.L().Info(fmt.Sprintf("match rule: %s", rule))
+	code, data, err := handler(c)
+	zap.L().Info(fmt.Sprintf("request proxy of rule: %s done, data %+v, code %d, err %+v", rule, data, code, err))
+	if c.Writer.Written() {
+		return
+	}
+	if err != nil {
+		msg := HttpResponse{Msg: err.Error()}
+		c.JSON(code, msg)
+		return
+	}
+	if code == 0 {
+		code = http.StatusOK
+	}
+	if data != nil {
+		c.JSON(code, data)
+	}
+}
+
+func (s *HttpServer) match(req *http.Request) (Handler, string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if handler, ok := s.hostHandlerMapper[req.Host]; ok {
+		return handler, "host " + req.Host, true
+	}
+
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if handler, ok := s.hostHandlerMapper[host]; ok {
+		return handler, "host " + host, true
+	}
+	var matched string
+	for wildcard := range s.wildcardHostHandlerMapper {
+		// *.example.com matches a.example.com and a.b.example.com
+		if strings.HasSuffix(host, wildcard[1:]) && len(wildcard) > len(matched) {
+			matched = wildcard
 		}
+	}
+	if matched != "" {
+		return s.wildcardHostHandlerMapper[matched], "wildcard host " + matched, true
+	}
 
-		return
+	for prefix := range s.pathPrefixHandlerMapper {
+		if matchPathPrefix(req.URL.Path, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+	if matched != "" {
+		return s.pathPrefixHandlerMapper[matched], "path prefix " + matched, true
 	}
-	for key, values := range c.Request.Header {
+
+	for key, values := range req.Header {
 		compare := fmt.Sprintf("%s=%s", key, strings.Join(values, ","))
 		if handler, ok := s.headerHandlerMapper[compare]; ok {
-			zap.L().Info(fmt.Sprintf("match header: %s,  handler %+v", compare, handler))
-			code, data, err := handler(c)
-			zap.L().Info(fmt.Sprintf("request proxy of header: %s done, data %s, code %d, err %+v",
-				compare, data, code, err))
-			return
+			return handler, "header " + compare, true
 		}
 	}
-	return
+	return nil, "", false
+}
+
+// matchPathPrefix matches prefix by path segments, /api matches /api and /api/v1 but not /apix
+func matchPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
 }
 
+// AddOrReplaceHostMap adds exact host rule, host like *.example.com is added as wildcard host rule
 func (s *HttpServer) AddOrReplaceHostMap(host string, handler Handler) error {
-	if _, exist := s.hostHandlerMapper[host]; exist {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	mapper := s.hostHandlerMapper
+	if strings.HasPrefix(host, "*.") {
+		mapper = s.wildcardHostHandlerMapper
+	}
+	if _, exist := mapper[host]; exist {
 		return fmt.Errorf("host handler map exist")
 	}
-	s.hostHandlerMapper[host] = handler
+	mapper[host] = handler
 	return nil
 }
 
 func (s *HttpServer) DeleteHostMap(host string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	delete(s.hostHandlerMapper, host)
+	delete(s.wildcardHostHandlerMapper, host)
+}
+
+func (s *HttpServer) AddOrReplacePathPrefixMap(prefix string, handler Handler) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exist := s.pathPrefixHandlerMapper[prefix]; exist {
+		return fmt.Errorf("path prefix handler map exist")
+	}
+	s.pathPrefixHandlerMapper[prefix] = handler
+	return nil
+}
+
+func (s *HttpServer) DeletePathPrefixMap(prefix string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pathPrefixHandlerMapper, prefix)
 }
 
 func (s *HttpServer) AddOrReplaceHeaderMap(header string, handler Handler) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	if _, exist := s.headerHandlerMapper[header]; exist {
 		return fmt.Errorf("header handler map exist")
 	}
@@ -102,9 +180,17 @@ func (s *HttpServer) AddOrReplaceHeaderMap(header string, handler Handler) error
 }
 
 func (s *HttpServer) DeleteHeaderMap(header string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	delete(s.headerHandlerMapper, header)
 }
 
+// Run serves http/1.1 and h2c, so that grpc and other http/2 streams are proxied without tls
 func (s *HttpServer) Run(addr string) error {
-	return s.gin.Run(addr)
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: h2c.NewHandler(s.gin, &http2.Server{}),
+	}
+	zap.L().Info("http server will listen on ", zap.String("addr", addr))
+	return srv.ListenAndServe()
 }
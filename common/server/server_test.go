@@ -0,0 +1,66 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func ruleHandler(rule string) Handler {
+	return func(c *gin.Context) (int, interface{}, error) {
+		return http.StatusOK, rule, nil
+	}
+}
+
+func TestHttpServerDispatch(t *testing.T) {
+	s := NewHttpServer()
+	s.AddOrReplaceHostMap("a.example.com", ruleHandler("exact"))
+	s.AddOrReplaceHostMap("*.example.com", ruleHandler("wildcard"))
+	s.AddOrReplaceHostMap("*.b.example.com", ruleHandler("wildcard-b"))
+	s.AddOrReplacePathPrefixMap("/api", ruleHandler("api"))
+	s.AddOrReplacePathPrefixMap("/api/v2", ruleHandler("api-v2"))
+	s.AddOrReplaceHeaderMap("X-Sensor=test", ruleHandler("header"))
+
+	cases := []struct {
+		method, host, path, header, rule string
+		code                             int
+	}{
+		{http.MethodGet, "a.example.com", "/", "", `"exact"`, http.StatusOK},
+		{http.MethodPatch, "a.example.com:8081", "/any/path", "", `"exact"`, http.StatusOK},
+		{http.MethodOptions, "c.example.com", "/", "", `"wildcard"`, http.StatusOK},
+		{http.MethodHead, "c.b.example.com", "/", "", `"wildcard-b"`, http.StatusOK},
+		{http.MethodPost, "other.com", "/api/v2/items", "", `"api-v2"`, http.StatusOK},
+		{http.MethodPost, "other.com", "/api/v1", "", `"api"`, http.StatusOK},
+		{http.MethodPost, "other.com", "/api", "", `"api"`, http.StatusOK},
+		{http.MethodPost, "other.com", "/api/v2x", "", `"api"`, http.StatusOK},
+		{http.MethodPost, "other.com", "/apix", "", "", http.StatusNotFound},
+		{http.MethodGet, "other.com", "/", "test", `"header"`, http.StatusOK},
+		{http.MethodGet, "other.com", "/", "", "", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Host = tc.host
+		if tc.header != "" {
+			req.Header.Set("X-Sensor", tc.header)
+		}
+		w := httptest.NewRecorder()
+		s.gin.ServeHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code, tc)
+		if tc.rule != "" && tc.method != http.MethodHead {
+			assert.Equal(t, tc.rule, w.Body.String(), tc)
+		}
+	}
+}
+
+func TestHttpServerRoutesEveryPath(t *testing.T) {
+	s := NewHttpServer()
+	s.AddOrReplacePathPrefixMap("/", ruleHandler("root"))
+
+	for _, path := range []string{"/healthz", "/readyz", "/metrics"} {
+		w := httptest.NewRecorder()
+		s.gin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, `"root"`, w.Body.String(), path)
+	}
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HostTLS is tls of host, certificates are read from secrets and reloaded once secrets are updated
+type HostTLS struct {
+	// Namespace of secrets
+	Namespace string
+	// Secret of type kubernetes.io/tls with tls.crt and tls.key
+	Secret string
+	// ClientCASecret with ca.crt enables mutual tls, clients must present certificates signed by it
+	ClientCASecret string
+}
+
+type parsedSecret struct {
+	ResourceVersion string
+	Cert            *tls.Certificate
+	Pool            *x509.CertPool
+}
+
+// tlsStore picks certificate of host by sni from secrets of GlobalSecretCache
+type tlsStore struct {
+	mutex  sync.RWMutex
+	hosts  map[string]HostTLS
+	parsed map[string]parsedSecret
+	// defaultCert is served to hosts without tls rule
+	defaultCert *tls.Certificate
+}
+
+func newTLSStore() *tlsStore {
+	return &tlsStore{
+		hosts:  make(map[string]HostTLS),
+		parsed: make(map[string]parsedSecret),
+	}
+}
+
+// AddTLSHost serves host with certificate of secret on tls listener, host may be wildcard like *.example.com
+func (s *HttpServer) AddTLSHost(host string, hostTLS HostTLS) {
+	s.tls.mutex.Lock()
+	defer s.tls.mutex.Unlock()
+	s.tls.hosts[host] = hostTLS
+}
+
+func (s *HttpServer) DeleteTLSHost(host string) {
+	s.tls.mutex.Lock()
+	defer s.tls.mutex.Unlock()
+	delete(s.tls.hosts, host)
+}
+
+// RunTLS serves https and http/2 with certificates by sni, default certificate is optional
+func (s *HttpServer) RunTLS(addr, defaultCertFile, defaultKeyFile string) error {
+	if defaultCertFile != "" && defaultKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(defaultCertFile, defaultKeyFile)
+		if err != nil {
+			return errors.Wrap(err, "load default certificate")
+		}
+		s.tls.defaultCert = &cert
+	}
+	srv := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if code, err := s.tls.verifyRequest(req); err != nil {
+				http.Error(w, err.Error(), code)
+				return
+			}
+			s.gin.ServeHTTP(w, req)
+		}),
+		TLSConfig: &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			GetConfigForClient: s.tls.configForClient,
+		},
+	}
+	zap.L().Info("https server will listen on ", zap.String("addr", addr))
+	return srv.ListenAndServeTLS("", "")
+}
+
+// hostTLS finds tls rule of server name, exact host is preferred to the longest wildcard
+func (t *tlsStore) hostTLS(serverName string) (HostTLS, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if h, _, err := net.SplitHostPort(serverName); err == nil {
+		serverName = h
+	}
+	if hostTLS, ok := t.hosts[serverName]; ok {
+		return hostTLS, true
+	}
+	var matched string
+	for host := range t.hosts {
+		if strings.HasPrefix(host, "*.") && strings.HasSuffix(serverName, host[1:]) && len(host) > len(matched) {
+			matched = host
+		}
+	}
+	if matched == "" {
+		return HostTLS{}, false
+	}
+	return t.hosts[matched], true
+}
+
+func (t *tlsStore) configForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	hostTLS, ok := t.hostTLS(hello.ServerName)
+	if !ok {
+		return t.defaultConfig(hello.ServerName)
+	}
+	secret, err := t.secret(hostTLS.Namespace, hostTLS.Secret)
+	// handshakes never wait for secrets to sync, mutual tls hosts reject requests over default certificate
+	if errors.Cause(err) == errSecretsNotSynced {
+		return t.defaultConfig(hello.ServerName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if secret.Cert == nil {
+		return nil, errors.New(fmt.Sprintf("no tls.crt in secret %s/%s", hostTLS.Namespace, hostTLS.Secret))
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*secret.Cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if hostTLS.ClientCASecret != "" {
+		ca, err := t.secret(hostTLS.Namespace, hostTLS.ClientCASecret)
+		if errors.Cause(err) == errSecretsNotSynced {
+			return t.defaultConfig(hello.ServerName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ca.Pool == nil {
+			return nil, errors.New(fmt.Sprintf("no ca.crt in secret %s/%s", hostTLS.Namespace, hostTLS.ClientCASecret))
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = ca.Pool
+	}
+	return config, nil
+}
+
+// defaultConfig serves default certificate to server name, error if there is none
+func (t *tlsStore) defaultConfig(serverName string) (*tls.Config, error) {
+	if t.defaultCert == nil {
+		return nil, errors.New(fmt.Sprintf("no certificate of host %s", serverName))
+	}
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*t.defaultCert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// verifyRequest rejects requests to mutual tls hosts over connections not verified for them. Certificate is
+// picked by sni, so Host of request must be the server name whose client certificate has been verified.
+func (t *tlsStore) verifyRequest(req *http.Request) (int, error) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	hostTLS, ok := t.hostTLS(host)
+	if !ok || hostTLS.ClientCASecret == "" {
+		return 0, nil
+	}
+	if req.TLS == nil || !strings.EqualFold(req.TLS.ServerName, host) {
+		return http.StatusMisdirectedRequest, errors.New(fmt.Sprintf("host %s requires tls connection to server name %s", host, host))
+	}
+	if len(req.TLS.VerifiedChains) == 0 {
+		return http.StatusForbidden, errors.New(fmt.Sprintf("host %s requires verified client certificate", host))
+	}
+	return 0, nil
+}
+
+// secret parses certificate and ca of secret, parsed ones are reused until secret is updated
+func (t *tlsStore) secret(namespace, name string) (parsedSecret, error) {
+	s, err := GlobalSecretCache.Get(namespace, name)
+	if err != nil {
+		return parsedSecret{}, err
+	}
+	key := fmt.Sprintf("%s/%s", namespace, name)
+	t.mutex.RLock()
+	parsed, ok := t.parsed[key]
+	t.mutex.RUnlock()
+	if ok && parsed.ResourceVersion == s.ResourceVersion {
+		return parsed, nil
+	}
+
+	parsed, err = parseSecret(s)
+	if err != nil {
+		return parsedSecret{}, errors.Wrapf(err, "parse secret %s", key)
+	}
+	zap.L().Info(fmt.Sprintf("load tls secret %s of version %s", key, s.ResourceVersion))
+	t.mutex.Lock()
+	t.parsed[key] = parsed
+	t.mutex.Unlock()
+	return parsed, nil
+}
+
+func parseSecret(s *v1.Secret) (parsedSecret, error) {
+	parsed := parsedSecret{ResourceVersion: s.ResourceVersion}
+	if crt, ok := s.Data[v1.TLSCertKey]; ok {
+		cert, err := tls.X509KeyPair(crt, s.Data[v1.TLSPrivateKeyKey])
+		if err != nil {
+			return parsed, err
+		}
+		parsed.Cert = &cert
+	}
+	if ca, ok := s.Data[v1.ServiceAccountRootCAKey]; ok {
+		parsed.Pool = x509.NewCertPool()
+		if !parsed.Pool.AppendCertsFromPEM(ca) {
+			return parsed, errors.New("no valid certificate in ca.crt")
+		}
+	}
+	if parsed.Cert == nil && parsed.Pool == nil {
+		return parsed, errors.New("neither tls.crt nor ca.crt in secret")
+	}
+	return parsed, nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	certutil "k8s.io/client-go/util/cert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSStoreHostTLS(t *testing.T) {
+	store := newTLSStore()
+	store.hosts["a.example.com"] = HostTLS{Secret: "exact"}
+	store.hosts["*.example.com"] = HostTLS{Secret: "wildcard"}
+	store.hosts["*.b.example.com"] = HostTLS{Secret: "longer"}
+
+	h, ok := store.hostTLS("a.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "exact", h.Secret)
+	h, ok = store.hostTLS("c.example.com:8443")
+	assert.True(t, ok)
+	assert.Equal(t, "wildcard", h.Secret)
+	h, ok = store.hostTLS("c.b.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "longer", h.Secret)
+	_, ok = store.hostTLS("example.org")
+	assert.False(t, ok)
+}
+
+func TestParseSecret(t *testing.T) {
+	crt, key, err := certutil.GenerateSelfSignedCertKey("a.example.com", nil, nil)
+	assert.Nil(t, err)
+
+	parsed, err := parseSecret(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{ResourceVersion: "1"},
+		Data:       map[string][]byte{v1.TLSCertKey: crt, v1.TLSPrivateKeyKey: key},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, parsed.Cert)
+	assert.Nil(t, parsed.Pool)
+	assert.Equal(t, "1", parsed.ResourceVersion)
+
+	parsed, err = parseSecret(&v1.Secret{Data: map[string][]byte{v1.ServiceAccountRootCAKey: crt}})
+	assert.Nil(t, err)
+	assert.NotNil(t, parsed.Pool)
+
+	_, err = parseSecret(&v1.Secret{Data: map[string][]byte{v1.TLSCertKey: crt}})
+	assert.NotNil(t, err)
+	_, err = parseSecret(&v1.Secret{Data: map[string][]byte{"other": crt}})
+	assert.NotNil(t, err)
+}
+
+func TestConfigForClientDefault(t *testing.T) {
+	store := newTLSStore()
+	_, err := store.configForClient(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	assert.NotNil(t, err)
+
+	crt, key, err := certutil.GenerateSelfSignedCertKey("a.example.com", nil, nil)
+	assert.Nil(t, err)
+	cert, err := tls.X509KeyPair(crt, key)
+	assert.Nil(t, err)
+	store.defaultCert = &cert
+	config, err := store.configForClient(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	assert.Nil(t, err)
+	assert.Len(t, config.Certificates, 1)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+}
+
+func TestConfigForClientNotSynced(t *testing.T) {
+	store := newTLSStore()
+	store.hosts["a.example.com"] = HostTLS{Namespace: "unsynced", Secret: "tls"}
+	GlobalSecretCache.Watch("unsynced")
+	defer GlobalSecretCache.Unwatch("unsynced")
+	_, err := store.configForClient(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	assert.NotNil(t, err)
+
+	crt, key, err := certutil.GenerateSelfSignedCertKey("a.example.com", nil, nil)
+	assert.Nil(t, err)
+	cert, err := tls.X509KeyPair(crt, key)
+	assert.Nil(t, err)
+	store.defaultCert = &cert
+	// handshake is served by default certificate until secrets are synced
+	config, err := store.configForClient(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	assert.Nil(t, err)
+	assert.Len(t, config.Certificates, 1)
+}
+
+func TestTLSVerifyRequest(t *testing.T) {
+	store := newTLSStore()
+	store.hosts["mtls.example.com"] = HostTLS{Secret: "mtls", ClientCASecret: "ca"}
+	store.hosts["public.example.com"] = HostTLS{Secret: "public"}
+	verified := [][]*x509.Certificate{{{}}}
+
+	cases := []struct {
+		host, serverName string
+		chains           [][]*x509.Certificate
+		code             int
+	}{
+		{"mtls.example.com", "mtls.example.com", verified, 0},
+		{"mtls.example.com:8443", "mtls.example.com", verified, 0},
+		{"public.example.com", "public.example.com", nil, 0},
+		// connection of public host without client certificate must not reach mtls host
+		{"mtls.example.com", "public.example.com", nil, http.StatusMisdirectedRequest},
+		{"mtls.example.com", "", nil, http.StatusMisdirectedRequest},
+		{"mtls.example.com", "mtls.example.com", nil, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = tc.host
+		req.TLS = &tls.ConnectionState{ServerName: tc.serverName, VerifiedChains: tc.chains}
+		code, err := store.verifyRequest(req)
+		assert.Equal(t, tc.code, code, tc)
+		assert.Equal(t, tc.code != 0, err != nil, tc)
+	}
+}
@@ -9,5 +9,26 @@ import (
 type Interface interface {
 	Exec(ctx context.Context, event event.Event) error
 
+	// Check is called periodically to scale down resource, scaleTime is idle time since lastEvent to scale down
 	Check(ctx context.Context, scaleTime time.Duration, lastEvent time.Time) error
 }
+
+// State is activity state of sensor, persisted so that scale to zero survives operator restarts
+type State struct {
+	LastEvent  time.Time
+	EventCount int64
+}
+
+// StateInterface is implemented by actors which persist state of sensor on their resource
+type StateInterface interface {
+	// LoadState returns nil state if no state is persisted
+	LoadState(ctx context.Context) (*State, error)
+	SaveState(ctx context.Context, state State) error
+}
+
+// ScaleInterface is implemented by actors whose resource can be scaled to given replicas
+type ScaleInterface interface {
+	// ReplicaRange is the min and max replicas of resource, max 0 means no limit
+	ReplicaRange() (min, max int32)
+	ScaleTo(ctx context.Context, replicas int32) error
+}
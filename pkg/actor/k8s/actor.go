@@ -7,15 +7,38 @@ import (
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
+	"sync"
+	"text/template"
+	"time"
 )
 
 type k8sActor struct {
-	OP     v1.KubernetesResourceOperation
+	OP v1.KubernetesResourceOperation
+	// Obj is the template object, Exec works on copies of it since events may be executed concurrently
 	Obj    *unstructured.Unstructured
+	mutex  sync.Mutex
 	GVR    schema.GroupVersionResource
 	Source *common.Resource
 	Cfg    *rest.Config
+	Scaler *Scaler
+	// Template renders object of create and patch operations with each event, nil if resource has no actions
+	Template      *template.Template
+	PatchStrategy k8stypes.PatchType
+	// replicas range of scale operation
+	MinReplica int32
+	MaxReplica int32
+	// scale operation options
+	DownMode         v1.ScaleDownMode
+	EventsPerReplica int32
+	DownCooldown     time.Duration
+	// ScaleByHPA leaves replicas of scaled object to hpa, scale operation only creates the object
+	ScaleByHPA bool
+
+	// times of events within scale rate window and last time replicas changed, guarded by mutex
+	eventTimes []time.Time
+	lastScale  time.Time
 }
 
 func NewK8SActor(t *v1.StandardK8SActor) (actor *k8sActor, err error) {
@@ -35,12 +58,58 @@ func NewK8SActor(t *v1.StandardK8SActor) (actor *k8sActor, err error) {
 
 	gvr := k8s2.GetGroupVersionResource(obj)
 
+	tpl, err := parseTemplate(t.Source.Resource.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	scaler, err := NewScaler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	actor = &k8sActor{
 		Obj:    obj,
 		GVR:    gvr,
 		OP:     t.Operation,
 		Source: t.Source.Resource,
 		Cfg:    cfg,
+		Scaler: scaler,
+
+		Template:      tpl,
+		PatchStrategy: t.PatchStrategy,
+
+		MinReplica:       t.ScaleMinReplica,
+		MaxReplica:       t.ScaleMaxReplica,
+		DownMode:         t.ScaleDownMode,
+		EventsPerReplica: t.ScaleEventsPerReplica,
+		DownCooldown:     time.Duration(t.ScaleDownCooldown) * time.Second,
+	}
+	switch actor.DownMode {
+	case "":
+		actor.DownMode = v1.ScaleDownToZero
+	case v1.ScaleDownToZero, v1.ScaleDownToMin:
+	default:
+		return nil, errors.Errorf("not support scale down mode %s", actor.DownMode)
+	}
+	if actor.DownCooldown <= 0 {
+		actor.DownCooldown = defaultScaleDownCooldown
+	}
+	if actor.MaxReplica > 0 && actor.MinReplica > actor.MaxReplica {
+		return nil, errors.Errorf("scale min replica %d is greater than max replica %d", actor.MinReplica, actor.MaxReplica)
+	}
+
+	if actor.OP == v1.Patch {
+		switch actor.PatchStrategy {
+		case "":
+			actor.PatchStrategy = k8stypes.MergePatchType
+		case k8stypes.MergePatchType, k8stypes.StrategicMergePatchType, k8stypes.ApplyPatchType:
+		default:
+			return nil, errors.Errorf("not support patch strategy %s, resource is patched as an object", actor.PatchStrategy)
+		}
+		if obj.GetName() == "" {
+			return nil, errors.New("name of resource to patch is empty")
+		}
 	}
 
 	// todo: obj reference with sensor version
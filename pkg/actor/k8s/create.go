@@ -4,38 +4,57 @@ import (
 	"context"
 	"eventrigger.com/operator/common/consts"
 	"eventrigger.com/operator/common/event"
+	"fmt"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 	v1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"regexp"
+	"strings"
 )
 
-func (r *k8sActor) CreateObj(ctx context.Context, event event.Event, cli dynamic.Interface) (err error) {
-	labels := r.Obj.GetLabels()
+var labelValueInvalidChars = regexp.MustCompile(`[^-_.a-zA-Z0-9]+`)
+
+// labelValue sanitizes value of event label, e.g. source like library/web becomes library-web
+func labelValue(key, value string) string {
+	if len(validation.IsValidLabelValue(value)) == 0 {
+		return value
+	}
+	sanitized := labelValueInvalidChars.ReplaceAllString(value, "-")
+	if len(sanitized) > validation.LabelValueMaxLength {
+		sanitized = sanitized[:validation.LabelValueMaxLength]
+	}
+	sanitized = strings.Trim(sanitized, "-_.")
+	zap.L().Warn(fmt.Sprintf("label %s of event is sanitized from %q to %q", key, value, sanitized))
+	return sanitized
+}
+
+func (r *k8sActor) CreateObj(ctx context.Context, obj *unstructured.Unstructured, event event.Event, cli dynamic.Interface) (err error) {
+	labels := obj.GetLabels()
 	if labels == nil {
 		labels = make(map[string]string)
 	}
 	eventDict := GetEventDict(event)
 	for k, v := range eventDict {
-		labels[k] = v
+		labels[k] = labelValue(k, v)
 	}
-	r.Obj.SetLabels(labels)
-	switch r.Obj.GetKind() {
+	obj.SetLabels(labels)
+	eventEnv := GetEventEnv(event)
+	switch obj.GetKind() {
 	case consts.PodKind:
 		var pod corev1.Pod
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(r.Obj.UnstructuredContent(), &pod)
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &pod)
 		if err != nil {
-			return errors.Wrapf(err, "convert obj gvr %s, %s to pod to create", r.GVR, r.Obj.GetName())
+			return errors.Wrapf(err, "convert obj gvr %s, %s to pod to create", r.GVR, obj.GetName())
 		}
-		for _, c := range pod.Spec.Containers {
-			var eventEnv []corev1.EnvVar
-			for k, v := range eventDict {
-				eventEnv = append(eventEnv, corev1.EnvVar{Name: k, Value: v})
-			}
-			c.Env = append(c.Env, eventEnv...)
+		for i := range pod.Spec.Containers {
+			pod.Spec.Containers[i].Env = append(pod.Spec.Containers[i].Env, eventEnv...)
 		}
 
 		cli, err := kubernetes.NewForConfig(r.Cfg)
@@ -46,16 +65,12 @@ func (r *k8sActor) CreateObj(ctx context.Context, event event.Event, cli dynamic
 		return err
 	case consts.JobKind:
 		var job v1.Job
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(r.Obj.UnstructuredContent(), &job)
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &job)
 		if err != nil {
 			return errors.Wrapf(err, "FromUnstructured to statefulset")
 		}
-		for _, c := range job.Spec.Template.Spec.Containers {
-			var eventEnv []corev1.EnvVar
-			for k, v := range eventDict {
-				eventEnv = append(eventEnv, corev1.EnvVar{Name: k, Value: v})
-			}
-			c.Env = append(c.Env, eventEnv...)
+		for i := range job.Spec.Template.Spec.Containers {
+			job.Spec.Template.Spec.Containers[i].Env = append(job.Spec.Template.Spec.Containers[i].Env, eventEnv...)
 		}
 		cli, err := kubernetes.NewForConfig(r.Cfg)
 		if err != nil {
@@ -64,7 +79,7 @@ func (r *k8sActor) CreateObj(ctx context.Context, event event.Event, cli dynamic
 		_, err = cli.BatchV1().Jobs(job.Namespace).Create(ctx, &job, metav1.CreateOptions{})
 		return err
 	}
-	_, err = cli.Resource(r.GVR).Namespace(r.Obj.GetNamespace()).Create(ctx, r.Obj, metav1.CreateOptions{})
+	_, err = cli.Resource(r.GVR).Namespace(obj.GetNamespace()).Create(ctx, obj, metav1.CreateOptions{})
 	if err != nil {
 		return errors.Errorf("failed to create object. err: %+v\n", err)
 	}
@@ -0,0 +1,43 @@
+package k8s
+
+import (
+	"context"
+	"eventrigger.com/operator/common/consts"
+	"eventrigger.com/operator/common/event"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic/fake"
+	"testing"
+)
+
+func TestCreateObjBatchLabels(t *testing.T) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	cli := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "ConfigMapList"})
+	r := &k8sActor{GVR: gvr}
+
+	batch, err := event.NewBatchEvent([]event.Event{
+		event.NewEvent("app", "registry", "library/web", "", `{"image":"r.io/library/web:v1"}`, ""),
+		event.NewEvent("app", "registry", "library/web", "", `{"image":"r.io/library/web:v2"}`, ""),
+	})
+	assert.Nil(t, err)
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetName("batch")
+	obj.SetNamespace("app")
+	assert.Nil(t, r.CreateObj(context.Background(), obj, batch, cli))
+
+	created, err := cli.Resource(gvr).Namespace("app").Get(context.Background(), "batch", metav1.GetOptions{})
+	assert.Nil(t, err)
+	labels := created.GetLabels()
+	assert.NotContains(t, labels, consts.EventData)
+	assert.Equal(t, "library-web", labels[consts.EventSource])
+	for k, v := range labels {
+		assert.Empty(t, validation.IsQualifiedName(k), k)
+		assert.Empty(t, validation.IsValidLabelValue(v), k)
+	}
+}
@@ -2,12 +2,10 @@ package k8s
 
 import (
 	"context"
-	"encoding/json"
 	"eventrigger.com/operator/common/consts"
 	commonEvent "eventrigger.com/operator/common/event"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/kubernetes"
 	"strconv"
 
 	v1 "eventrigger.com/operator/pkg/api/core/v1"
@@ -27,55 +25,8 @@ var clusterResources = map[string]bool{
 	"nodes":      true,
 }
 
-// ScaleObjTo only scale to 0 or increase replicas
-func ScaleObjTo(ctx context.Context, cli *kubernetes.Clientset, obj *unstructured.Unstructured, replicas int32) (err error) {
-	namespace := obj.GetNamespace()
-	name := obj.GetName()
-	patchData := map[string]interface{}{
-		"spec": map[string]interface{}{
-			"replicas": replicas,
-		},
-	}
-	patchByte, err := json.Marshal(patchData)
-	if err != nil {
-		return err
-	}
-
-	switch obj.GetKind() {
-	case consts.StatefulSetKind:
-		s, err := cli.AppsV1().StatefulSets(namespace).GetScale(ctx, name, metav1.GetOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "get scale for statefulset %s-%s", namespace, name)
-		}
-		if replicas == 0 || s.Spec.Replicas < replicas {
-			_, err = cli.AppsV1().StatefulSets(namespace).Patch(ctx, s.Name, types.MergePatchType, patchByte, metav1.PatchOptions{})
-			if err != nil {
-				return errors.Wrapf(err, "scale statefulset %s-%s to %d", namespace, name, replicas)
-			}
-		}
-		return nil
-	case consts.DeploymentKind:
-		d, err := cli.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
-		if apierrors.IsNotFound(err) && replicas == 0 {
-			zap.L().Info("deployment not exist scale to zero success.")
-			return nil
-		}
-		if err != nil {
-			return errors.Wrapf(err, "get scale for deployment %s-%s", namespace, name)
-		}
-		if replicas == 0 || d.Spec.Replicas < replicas {
-			_, err = cli.AppsV1().Deployments(namespace).Patch(ctx, d.Name, types.MergePatchType, patchByte, metav1.PatchOptions{})
-			if err != nil {
-				return errors.Wrapf(err, "scale deployment %s-%s to %d", namespace, name, replicas)
-			}
-		}
-		return nil
-	default:
-		return errors.New(fmt.Sprintf("not supported %s %s-%s scale", obj.GetKind(), namespace, name))
-	}
-}
-
 func (r *k8sActor) Exec(ctx context.Context, event commonEvent.Event) error {
+	r.mutex.Lock()
 	namespace := ""
 	if _, isClusterResource := clusterResources[r.GVR.Resource]; !isClusterResource {
 		namespace = r.Obj.GetNamespace()
@@ -88,6 +39,18 @@ func (r *k8sActor) Exec(ctx context.Context, event commonEvent.Event) error {
 		}
 	}
 	r.Obj.SetNamespace(namespace)
+	obj := r.Obj.DeepCopy()
+	r.mutex.Unlock()
+	if r.Template != nil && (r.OP == v1.Create || r.OP == v1.Patch) {
+		rendered, err := r.render(event)
+		if err != nil {
+			return err
+		}
+		if rendered.GetNamespace() == "" {
+			rendered.SetNamespace(namespace)
+		}
+		obj = rendered
+	}
 	zap.L().Info("starting operate trigger resource", zap.String("gvr", r.GVR.String()),
 		zap.String("op", string(r.OP)), zap.String("namespace", namespace))
 
@@ -101,9 +64,11 @@ func (r *k8sActor) Exec(ctx context.Context, event commonEvent.Event) error {
 
 	switch r.OP {
 	case v1.Create:
-		return r.CreateObj(ctx, event, dynamicClient)
+		return r.CreateObj(ctx, obj, event, dynamicClient)
+	case v1.Patch:
+		return r.PatchObj(ctx, obj, dynamicClient)
 	case v1.Delete:
-		_, err = dynamicClient.Resource(r.GVR).Namespace(namespace).Get(ctx, r.Obj.GetName(), metav1.GetOptions{})
+		_, err = dynamicClient.Resource(r.GVR).Namespace(namespace).Get(ctx, obj.GetName(), metav1.GetOptions{})
 
 		if err != nil && apierrors.IsNotFound(err) {
 			zap.L().Info("object not found, nothing to delete...")
@@ -112,36 +77,24 @@ func (r *k8sActor) Exec(ctx context.Context, event commonEvent.Event) error {
 			return errors.Errorf("failed to retrieve existing object. err: %+v\n", err)
 		}
 
-		err = dynamicClient.Resource(r.GVR).Delete(ctx, r.Obj.GetName(), metav1.DeleteOptions{})
+		err = dynamicClient.Resource(r.GVR).Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
 		if err != nil {
 			return errors.Errorf("failed to delete object. err: %+v\n", err)
 		}
 		return nil
 	case v1.Scale:
-		// Create if not exist
-		// see label whether scaleToZero ScaleToZeroEnable
-		k8sCli, err := kubernetes.NewForConfig(r.Cfg)
+		// Create if not exist, then scale up proportionally to event rate
+		existObj, err := r.getOrCreate(ctx, dynamicClient, obj)
 		if err != nil {
 			return err
 		}
-		var existObj *unstructured.Unstructured
-		// todo: update resource
-		existObj, err = dynamicClient.Resource(r.GVR).Namespace(r.Obj.GetNamespace()).Get(ctx, r.Obj.GetName(), metav1.GetOptions{})
-		if err != nil {
-			zap.L().Info(fmt.Sprintf("Get resource of gvr %s, name %s, err %s", r.GVR.String(), r.Obj.GetName(), err.Error()))
-			if apierrors.IsNotFound(err) {
-				existObj, err = dynamicClient.Resource(r.GVR).Namespace(r.Obj.GetNamespace()).Create(ctx, r.Obj, metav1.CreateOptions{})
-				if err != nil {
-					zap.L().Info(fmt.Sprintf("Create resource of gvr %s, name %s, err %s", r.GVR.String(), r.Obj.GetName(), err.Error()))
-					return err
-				}
-			} else {
-				return errors.Wrapf(err, "failed scale when get obj")
-			}
+		if r.ScaleByHPA {
+			return nil
 		}
-		// todo: HPA with event
-		// todo: HPA with resource/limit
-		err = ScaleObjTo(ctx, k8sCli, existObj, 1)
+		r.mutex.Lock()
+		events := r.recordEvent(time.Now())
+		r.mutex.Unlock()
+		err = r.scaleUp(ctx, existObj, activeReplicas(events, r.EventsPerReplica, r.MinReplica, r.MaxReplica))
 		if err != nil {
 			return errors.Errorf("failed to scaleObjTo. err: %+v\n", err)
 		}
@@ -151,25 +104,111 @@ func (r *k8sActor) Exec(ctx context.Context, event commonEvent.Event) error {
 	}
 }
 
+// getOrCreate get the object to scale, it is created from template if not exist
+func (r *k8sActor) getOrCreate(ctx context.Context, dynamicClient dynamic.Interface, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	// todo: update resource
+	existObj, err := dynamicClient.Resource(r.GVR).Namespace(obj.GetNamespace()).Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err == nil {
+		return existObj, nil
+	}
+	zap.L().Info(fmt.Sprintf("Get resource of gvr %s, name %s, err %s", r.GVR.String(), obj.GetName(), err.Error()))
+	if !apierrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "failed scale when get obj")
+	}
+	existObj, err = dynamicClient.Resource(r.GVR).Namespace(obj.GetNamespace()).Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil {
+		zap.L().Info(fmt.Sprintf("Create resource of gvr %s, name %s, err %s", r.GVR.String(), obj.GetName(), err.Error()))
+		return nil, err
+	}
+	return existObj, nil
+}
+
+func (r *k8sActor) ReplicaRange() (min, max int32) {
+	return r.MinReplica, r.MaxReplica
+}
+
+// ScaleTo scale resource to exactly replicas, resource is created if not exist and replicas is not 0
+func (r *k8sActor) ScaleTo(ctx context.Context, replicas int32) error {
+	if r.OP != v1.Scale {
+		return errors.Errorf("actor operation %s cannot scale", r.OP)
+	}
+	if r.ScaleByHPA {
+		return errors.Errorf("%s %s is scaled by hpa", r.GVR, r.Obj.GetName())
+	}
+	r.mutex.Lock()
+	obj := r.Obj.DeepCopy()
+	r.mutex.Unlock()
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace("default")
+	}
+
+	if replicas > 0 {
+		dynamicClient, err := dynamic.NewForConfig(r.Cfg)
+		if err != nil {
+			return err
+		}
+		obj, err = r.getOrCreate(ctx, dynamicClient, obj)
+		if err != nil {
+			return err
+		}
+	}
+	err := r.Scaler.SetReplicas(ctx, obj, replicas)
+	if err != nil {
+		return errors.Wrapf(err, "scale %s %s/%s to %d", r.GVR, obj.GetNamespace(), obj.GetName(), replicas)
+	}
+	return nil
+}
+
+// Check scales down to idle replicas after scaleTime without events, or to replicas of event rate otherwise.
+// Replicas are halved towards desired at most once per DownCooldown. scaleTime 0 means never idle.
 func (r *k8sActor) Check(ctx context.Context, scaleTime time.Duration, lastEvent time.Time) error {
+	if r.OP != v1.Scale || r.ScaleByHPA {
+		return nil
+	}
 	now := time.Now()
-	if lastEvent.Add(scaleTime).After(now) {
-		zap.L().Info(fmt.Sprintf("k8s actor check but gvr %s, name %s not meet scale time, lastEvent %s, scaleZero %s, now %s ",
-			r.GVR, r.Obj.GetName(), lastEvent, scaleTime, now))
+	r.mutex.Lock()
+	obj := r.Obj.DeepCopy()
+	events := r.recentEvents(now)
+	lastScale := r.lastScale
+	r.mutex.Unlock()
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace("default")
+	}
+
+	var desired int32
+	if scaleTime > 0 && !lastEvent.Add(scaleTime).After(now) {
+		desired = r.idleReplicas()
+	} else if r.EventsPerReplica > 0 {
+		desired = activeReplicas(events, r.EventsPerReplica, r.MinReplica, r.MaxReplica)
+	} else {
+		zap.L().Debug(fmt.Sprintf("k8s actor check but gvr %s, name %s not meet scale time, lastEvent %s, scaleZero %s, now %s ",
+			r.GVR, obj.GetName(), lastEvent, scaleTime, now))
 		return nil
 	}
 
-	zap.L().Info(fmt.Sprintf("resource gvr:%s, name %s enable scale to zero and time meet since last event",
-		r.GVR, r.Obj.GetName()))
-	k8sCli, err := kubernetes.NewForConfig(r.Cfg)
+	current, exist, err := r.Scaler.GetReplicas(ctx, obj)
 	if err != nil {
 		return err
 	}
+	if !exist || current <= desired {
+		return nil
+	}
+	if lastScale.Add(r.DownCooldown).After(now) {
+		zap.L().Info(fmt.Sprintf("k8s actor gvr %s, name %s scale down from %d to %d within cooldown since %s",
+			r.GVR, obj.GetName(), current, desired, lastScale))
+		return nil
+	}
 
-	err = ScaleObjTo(ctx, k8sCli, r.Obj, 0)
+	replicas := stepDown(current, desired)
+	zap.L().Info(fmt.Sprintf("scale down gvr %s, name %s from %d to %d, desired %d",
+		r.GVR, obj.GetName(), current, replicas, desired))
+	err = r.Scaler.SetReplicas(ctx, obj, replicas)
 	if err != nil {
-		return errors.Errorf("failed to scaleToZero. err: %+v\n", err)
+		return errors.Errorf("failed to scale down. err: %+v\n", err)
 	}
+	r.mutex.Lock()
+	r.lastScale = now
+	r.mutex.Unlock()
 	return nil
 }
 
@@ -177,6 +216,7 @@ func (r *k8sActor) String() string {
 	return fmt.Sprintf("%s-%s", r.GVR.String(), r.OP)
 }
 
+// GetEventDict is the labels of event set on created objects, data of event is delivered by env and templates only
 func GetEventDict(event commonEvent.Event) (dict map[string]string) {
 	dict = map[string]string{}
 	if event.UUID != "" {
@@ -186,7 +226,18 @@ func GetEventDict(event commonEvent.Event) (dict map[string]string) {
 	dict[consts.EventNamespace] = event.Namespace
 	dict[consts.EventType] = event.Type
 	dict[consts.EventSource] = event.Source
-	dict[consts.EventData] = event.Data
 	dict[consts.EventVersion] = event.Version
 	return dict
 }
+
+// GetEventEnv is the env of event injected into containers, data of event may be a json array of batch events
+func GetEventEnv(event commonEvent.Event) (env []corev1.EnvVar) {
+	return []corev1.EnvVar{
+		{Name: consts.EnvEventUUID, Value: event.UUID},
+		{Name: consts.EnvEventNamespace, Value: event.Namespace},
+		{Name: consts.EnvEventType, Value: event.Type},
+		{Name: consts.EnvEventSource, Value: event.Source},
+		{Name: consts.EnvEventData, Value: event.Data},
+		{Name: consts.EnvEventVersion, Value: event.Version},
+	}
+}
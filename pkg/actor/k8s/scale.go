@@ -0,0 +1,85 @@
+package k8s
+
+import (
+	"context"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"fmt"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"time"
+)
+
+const (
+	// scaleRateWindow is the window event rate is counted within
+	scaleRateWindow          = time.Minute
+	defaultScaleDownCooldown = 60 * time.Second
+)
+
+// recordEvent adds event at now to rate window and returns events within window, caller should hold the mutex
+func (r *k8sActor) recordEvent(now time.Time) int32 {
+	r.eventTimes = append(r.eventTimes, now)
+	return r.recentEvents(now)
+}
+
+// recentEvents drops events out of rate window and returns the rest, caller should hold the mutex
+func (r *k8sActor) recentEvents(now time.Time) int32 {
+	i := 0
+	for i < len(r.eventTimes) && !r.eventTimes[i].After(now.Add(-scaleRateWindow)) {
+		i++
+	}
+	r.eventTimes = r.eventTimes[i:]
+	return int32(len(r.eventTimes))
+}
+
+// activeReplicas is replicas while events are received, proportional to events within rate window
+func activeReplicas(events, perReplica, min, max int32) int32 {
+	replicas := min
+	if perReplica > 0 {
+		if n := (events + perReplica - 1) / perReplica; n > replicas {
+			replicas = n
+		}
+	}
+	if replicas < 1 {
+		replicas = 1
+	}
+	if max > 0 && replicas > max {
+		replicas = max
+	}
+	return replicas
+}
+
+// idleReplicas is replicas after ScaleToZeroTime without events
+func (r *k8sActor) idleReplicas() int32 {
+	if r.DownMode == v1.ScaleDownToMin {
+		return r.MinReplica
+	}
+	return 0
+}
+
+// stepDown halves replicas above desired, so that replicas are scaled down gradually
+func stepDown(current, desired int32) int32 {
+	if current <= desired {
+		return current
+	}
+	return desired + (current-desired)/2
+}
+
+// scaleUp scales obj up to desired, replicas are never decreased
+func (r *k8sActor) scaleUp(ctx context.Context, obj *unstructured.Unstructured, desired int32) error {
+	current, _, err := r.Scaler.GetReplicas(ctx, obj)
+	if err != nil {
+		return err
+	}
+	if current >= desired {
+		return nil
+	}
+	zap.L().Info(fmt.Sprintf("scale up %s %s/%s from %d to %d", r.GVR, obj.GetNamespace(), obj.GetName(), current, desired))
+	err = r.Scaler.SetReplicas(ctx, obj, desired)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	r.lastScale = time.Now()
+	r.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,45 @@
+package k8s
+
+import (
+	"context"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+	"time"
+)
+
+func TestActiveReplicas(t *testing.T) {
+	// without events per replica, scale up to min but at least 1
+	assert.Equal(t, int32(1), activeReplicas(100, 0, 0, 0))
+	assert.Equal(t, int32(2), activeReplicas(100, 0, 2, 5))
+	// proportional to events within window
+	assert.Equal(t, int32(3), activeReplicas(25, 10, 0, 5))
+	assert.Equal(t, int32(5), activeReplicas(100, 10, 0, 5))
+	assert.Equal(t, int32(2), activeReplicas(5, 10, 2, 5))
+}
+
+func TestStepDown(t *testing.T) {
+	assert.Equal(t, int32(4), stepDown(8, 0))
+	assert.Equal(t, int32(0), stepDown(1, 0))
+	assert.Equal(t, int32(3), stepDown(4, 2))
+	assert.Equal(t, int32(2), stepDown(2, 2))
+	assert.Equal(t, int32(1), stepDown(1, 3))
+}
+
+func TestRecentEvents(t *testing.T) {
+	r := &k8sActor{}
+	now := time.Now()
+	r.recordEvent(now.Add(-2 * scaleRateWindow))
+	r.recordEvent(now.Add(-time.Second))
+	assert.Equal(t, int32(2), r.recordEvent(now))
+	assert.Equal(t, int32(0), r.recentEvents(now.Add(scaleRateWindow)))
+}
+
+func TestScaleByHPA(t *testing.T) {
+	// replicas are left to hpa, nil scaler is never touched
+	r := &k8sActor{OP: v1.Scale, ScaleByHPA: true, Obj: &unstructured.Unstructured{}, MinReplica: 1, EventsPerReplica: 1}
+	r.recordEvent(time.Now())
+	assert.Nil(t, r.Check(context.Background(), time.Second, time.Now().Add(-time.Hour)))
+	assert.NotNil(t, r.ScaleTo(context.Background(), 2))
+}
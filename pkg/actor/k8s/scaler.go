@@ -0,0 +1,101 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/util/retry"
+)
+
+// Scaler gets and sets replicas of any resource implementing the scale subresource,
+// e.g. Deployment, StatefulSet, ReplicaSet, Argo Rollout or custom resources
+type Scaler struct {
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+	scales scale.ScalesGetter
+}
+
+// NewScaler resolves resources and scale kinds by discovery, api server is not requested until first use
+func NewScaler(cfg *rest.Config) (*Scaler, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "new discovery client")
+	}
+	cached := memory.NewMemCacheClient(discoveryClient)
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(cached)
+	scales, err := scale.NewForConfig(cfg, mapper, dynamic.LegacyAPIPathResolverFunc, scale.NewDiscoveryScaleKindResolver(cached))
+	if err != nil {
+		return nil, errors.Wrap(err, "new scale client")
+	}
+	return &Scaler{mapper: mapper, scales: scales}, nil
+}
+
+// groupResource maps kind of obj to its resource, discovery cache is refreshed once for kinds installed later
+func (s *Scaler) groupResource(obj *unstructured.Unstructured) (schema.GroupResource, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		s.mapper.Reset()
+		mapping, err = s.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return schema.GroupResource{}, errors.Wrapf(err, "map kind %s to resource", gvk)
+	}
+	return mapping.Resource.GroupResource(), nil
+}
+
+// GetReplicas gets replicas of obj, exist is false if obj is not found
+func (s *Scaler) GetReplicas(ctx context.Context, obj *unstructured.Unstructured) (replicas int32, exist bool, err error) {
+	gr, err := s.groupResource(obj)
+	if err != nil {
+		return 0, false, err
+	}
+	sc, err := s.scales.Scales(obj.GetNamespace()).Get(ctx, gr, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "get scale for %s %s-%s", gr, obj.GetNamespace(), obj.GetName())
+	}
+	return sc.Spec.Replicas, true, nil
+}
+
+// SetReplicas scales obj to exactly replicas, scaling a not found obj to zero succeeds
+func (s *Scaler) SetReplicas(ctx context.Context, obj *unstructured.Unstructured, replicas int32) error {
+	gr, err := s.groupResource(obj)
+	if err != nil {
+		return err
+	}
+	namespace := obj.GetNamespace()
+	name := obj.GetName()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		sc, err := s.scales.Scales(namespace).Get(ctx, gr, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) && replicas == 0 {
+			zap.L().Info(fmt.Sprintf("%s %s-%s not exist scale to zero success.", gr, namespace, name))
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "get scale for %s %s-%s", gr, namespace, name)
+		}
+		if sc.Spec.Replicas == replicas {
+			return nil
+		}
+		sc.Spec.Replicas = replicas
+		_, err = s.scales.Scales(namespace).Update(ctx, gr, sc, metav1.UpdateOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "scale %s %s-%s to %d", gr, namespace, name, replicas)
+		}
+		return nil
+	})
+}
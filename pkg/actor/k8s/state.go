@@ -0,0 +1,97 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"eventrigger.com/operator/common/consts"
+	"eventrigger.com/operator/pkg/actor"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"strconv"
+	"time"
+)
+
+// LoadState reads state from annotations of scaled object, state is nil if object or annotations not exist
+func (r *k8sActor) LoadState(ctx context.Context) (*actor.State, error) {
+	if r.OP != v1.Scale {
+		return nil, nil
+	}
+	dynamicClient, err := dynamic.NewForConfig(r.Cfg)
+	if err != nil {
+		return nil, err
+	}
+	namespace, name := r.objKey()
+	obj, err := dynamicClient.Resource(r.GVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s %s/%s state", r.GVR, namespace, name)
+	}
+	return parseState(obj.GetAnnotations())
+}
+
+// SaveState patches state as annotations of scaled object, nothing is saved if object not exist
+func (r *k8sActor) SaveState(ctx context.Context, state actor.State) error {
+	if r.OP != v1.Scale {
+		return nil
+	}
+	dynamicClient, err := dynamic.NewForConfig(r.Cfg)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				consts.LastEventTimeAnnotation: state.LastEvent.UTC().Format(time.RFC3339),
+				consts.EventCountAnnotation:    strconv.FormatInt(state.EventCount, 10),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	namespace, name := r.objKey()
+	_, err = dynamicClient.Resource(r.GVR).Namespace(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "save %s %s/%s state", r.GVR, namespace, name)
+	}
+	return nil
+}
+
+func (r *k8sActor) objKey() (namespace, name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	namespace = r.Obj.GetNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+	return namespace, r.Obj.GetName()
+}
+
+func parseState(annotations map[string]string) (*actor.State, error) {
+	lastEvent, ok := annotations[consts.LastEventTimeAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	state := &actor.State{}
+	var err error
+	state.LastEvent, err = time.Parse(time.RFC3339, lastEvent)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse annotation %s", consts.LastEventTimeAnnotation)
+	}
+	if count, ok := annotations[consts.EventCountAnnotation]; ok {
+		state.EventCount, err = strconv.ParseInt(count, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse annotation %s", consts.EventCountAnnotation)
+		}
+	}
+	return state, nil
+}
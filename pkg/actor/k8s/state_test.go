@@ -0,0 +1,26 @@
+package k8s
+
+import (
+	"eventrigger.com/operator/common/consts"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseState(t *testing.T) {
+	state, err := parseState(map[string]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	state, err = parseState(map[string]string{
+		consts.LastEventTimeAnnotation: "2021-10-01T08:00:00Z",
+		consts.EventCountAnnotation:    "42",
+	})
+	if assert.NoError(t, err) {
+		assert.True(t, state.LastEvent.Equal(time.Date(2021, 10, 1, 8, 0, 0, 0, time.UTC)))
+		assert.Equal(t, int64(42), state.EventCount)
+	}
+
+	_, err = parseState(map[string]string{consts.LastEventTimeAnnotation: "yesterday"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	commonEvent "eventrigger.com/operator/common/event"
+	k8s2 "eventrigger.com/operator/common/k8s"
+	"fmt"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+const (
+	fieldManager = "eventrigger"
+
+	// safeScalarFunc is appended to every output of template which is not quoted by quote or toJson
+	safeScalarFunc = "safeScalar"
+)
+
+// templateFuncs quote values of events, so that they cannot inject fields into resources
+var templateFuncs = template.FuncMap{
+	"quote":        quote,
+	"toJson":       toJson,
+	safeScalarFunc: safeScalar,
+}
+
+// templateData is what resource templates are rendered with, e.g. image: {{ .Data.image | quote }}
+type templateData struct {
+	Event commonEvent.Event
+	// Data is data of event decoded from json, or the string itself if it is not json
+	Data interface{}
+}
+
+// parseTemplate parses resource as template if it has actions, resource without actions is nil template
+func parseTemplate(resource []byte) (*template.Template, error) {
+	if !bytes.Contains(resource, []byte("{{")) {
+		return nil, nil
+	}
+	tpl, err := template.New("resource").Option("missingkey=error").Funcs(templateFuncs).Parse(string(resource))
+	if err != nil {
+		return nil, errors.Wrap(err, "parse resource template")
+	}
+	for _, t := range tpl.Templates() {
+		if t.Tree != nil {
+			escapeNode(t.Tree, t.Tree.Root)
+		}
+	}
+	return tpl, nil
+}
+
+// escapeNode pipes outputs of actions to safeScalar unless they are quoted already
+func escapeNode(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeNode(tree, child)
+		}
+	case *parse.ActionNode:
+		// assignments print nothing
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok {
+			if _, quoted := templateFuncs[ident.Ident]; quoted {
+				return
+			}
+		}
+		ident := parse.NewIdentifier(safeScalarFunc).SetTree(tree).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{ident}})
+	case *parse.IfNode:
+		escapeNode(tree, n.List)
+		escapeNode(tree, n.ElseList)
+	case *parse.RangeNode:
+		escapeNode(tree, n.List)
+		escapeNode(tree, n.ElseList)
+	case *parse.WithNode:
+		escapeNode(tree, n.List)
+		escapeNode(tree, n.ElseList)
+	}
+}
+
+// quote renders value as double quoted yaml string
+func quote(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return toJson(s)
+	}
+	return toJson(fmt.Sprint(v))
+}
+
+// toJson renders value as json, which is yaml of flow style
+func toJson(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal template value")
+	}
+	return string(b), nil
+}
+
+// safeScalar refuses values which may break out of yaml scalar
+func safeScalar(v interface{}) (string, error) {
+	s := fmt.Sprint(v)
+	if strings.ContainsAny(s, "\n\r\"'\\") {
+		return "", errors.New(fmt.Sprintf("value %q of template is not a safe yaml scalar, use quote or toJson", s))
+	}
+	return s, nil
+}
+
+// render renders template with event into object
+func (r *k8sActor) render(event commonEvent.Event) (*unstructured.Unstructured, error) {
+	data := templateData{Event: event, Data: event.Data}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(event.Data), &decoded); err == nil {
+		data.Data = decoded
+	}
+	var buf bytes.Buffer
+	if err := r.Template.Execute(&buf, data); err != nil {
+		return nil, errors.Wrapf(err, "render resource template with event %s", event.UUID)
+	}
+	obj, err := k8s2.DecodeAndUnstructure(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "decode rendered resource")
+	}
+	return obj, nil
+}
+
+// PatchObj patches existing object with obj by PatchStrategy, fields absent from obj are kept
+func (r *k8sActor) PatchObj(ctx context.Context, obj *unstructured.Unstructured, cli dynamic.Interface) error {
+	body, err := obj.MarshalJSON()
+	if err != nil {
+		return errors.Wrap(err, "marshal patch")
+	}
+	opts := metav1.PatchOptions{}
+	if r.PatchStrategy == k8stypes.ApplyPatchType {
+		force := true
+		opts.FieldManager = fieldManager
+		opts.Force = &force
+	}
+	_, err = cli.Resource(r.GVR).Namespace(obj.GetNamespace()).Patch(ctx, obj.GetName(), r.PatchStrategy, body, opts)
+	if err != nil {
+		return errors.Errorf("failed to patch object. err: %+v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package k8s
+
+import (
+	"eventrigger.com/operator/common/event"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	tpl, err := parseTemplate([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: "{{ .Data.image }}"
+          env:
+            - name: SOURCE
+              value: "{{ .Event.Source }}"
+`))
+	assert.Nil(t, err)
+	assert.NotNil(t, tpl)
+	r := &k8sActor{Template: tpl}
+
+	obj, err := r.render(event.NewEvent("", "registry", "library/web", "", `{"image":"r.io/library/web:v2"}`, ""))
+	assert.Nil(t, err)
+	assert.Equal(t, "web", obj.GetName())
+	containers := obj.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	container := containers[0].(map[string]interface{})
+	assert.Equal(t, "r.io/library/web:v2", container["image"])
+	assert.Equal(t, "library/web", container["env"].([]interface{})[0].(map[string]interface{})["value"])
+
+	// missing key of data fails instead of rendering empty image
+	_, err = r.render(event.NewEvent("", "registry", "library/web", "", `{"tag":"v2"}`, ""))
+	assert.NotNil(t, err)
+
+	// unquoted value breaking out of its scalar is refused, quoted value stays a single scalar
+	malicious := `{"image":"r.io/web:v2\"\n          command: [\"sh\"]\n          x: \""}`
+	_, err = r.render(event.NewEvent("", "registry", "library/web", "", malicious, ""))
+	assert.NotNil(t, err)
+
+	tpl, err = parseTemplate([]byte("kind: Pod\nmetadata:\n  name: p\nspec:\n  containers:\n    - image: {{ .Data.image | quote }}\n      name: {{ .Event.Source | toJson }}\n"))
+	assert.Nil(t, err)
+	r = &k8sActor{Template: tpl}
+	obj, err = r.render(event.NewEvent("", "registry", "library/web", "", malicious, ""))
+	assert.Nil(t, err)
+	container = obj.Object["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "r.io/web:v2\"\n          command: [\"sh\"]\n          x: \"", container["image"])
+	assert.Equal(t, "library/web", container["name"])
+	assert.Nil(t, container["command"])
+
+	tpl, err = parseTemplate([]byte("kind: Pod\nmetadata:\n  name: p\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, tpl)
+}
@@ -20,7 +20,8 @@ const (
 
 // StandardK8SActor is the standard Kubernetes resource trigger
 type StandardK8SActor struct {
-	// Source of the K8s resource file(s)
+	// Source of the K8s resource file(s). Resource of create and patch operations may be a go template
+	// rendered with each event, e.g. image: {{ .Data.image | quote }}
 	Source *ArtifactLocation `json:"source,omitempty" protobuf:"bytes,1,opt,name=source"`
 	// Operation refers to the type of operation performed on the k8s resource.
 	// Default value is Create.
@@ -28,18 +29,17 @@ type StandardK8SActor struct {
 	Operation KubernetesResourceOperation `json:"operation,omitempty" protobuf:"bytes,2,opt,name=operation,casttype=KubernetesResourceOperation"`
 	// PatchStrategy controls the K8s object patching strategy when the trigger operation is specified as patch.
 	// possible values:
-	// "application/json-patch+json"
 	// "application/merge-patch+json"
 	// "application/strategic-merge-patch+json"
 	// "application/apply-patch+yaml".
 	// Defaults to "application/merge-patch+json"
 	// +optional
 	PatchStrategy k8stypes.PatchType `json:"patchStrategy,omitempty" protobuf:"bytes,3,opt,name=patchStrategy,casttype=k8s.io/apimachinery/pkg/types.PatchType"`
-	// ScaleToZeroTime whether to scale to zero if  now - last event receive >=  scaleToZeroTime second
+	// ScaleToZeroTime scales down by ScaleDownMode if now - last event receive >= scaleToZeroTime second, 0 means disabled
 	ScaleToZeroTime int32 `json:"scaleToZeroTime,omitempty" protobuf:"bytes,4,opt,name=scaleToZeroTime"`
-	// ScaleMaxReplica whether to scale to zero if  now - last event receive >=  scaleToZeroTime second
+	// ScaleMaxReplica is the max replicas scale operation scales up to, 0 means no limit
 	ScaleMaxReplica int32 `json:"scaleMaxReplica,omitempty" protobuf:"bytes,5,opt,name=scaleMaxReplica"`
-	// ScaleMinReplica whether to scale to zero if  now - last event receive >=  scaleToZeroTime second
+	// ScaleMinReplica is the min replicas while events are received
 	ScaleMinReplica int32 `json:"scaleMinReplica,omitempty" protobuf:"bytes,6,opt,name=scaleMinReplica"`
 	// LiveObject specifies whether the resource should be directly fetched from K8s instead
 	// of being marshaled from the resource artifact. If set to true, the resource artifact
@@ -49,8 +49,32 @@ type StandardK8SActor struct {
 	// Only valid for operation type `update`
 	// +optional
 	LiveObject bool `json:"liveObject,omitempty" protobuf:"varint,7,opt,name=liveObject"`
+	// ScaleDownMode is where to scale down after ScaleToZeroTime without events, zero or min.
+	// Defaults to zero
+	// +optional
+	ScaleDownMode ScaleDownMode `json:"scaleDownMode,omitempty" protobuf:"bytes,8,opt,name=scaleDownMode,casttype=ScaleDownMode"`
+	// ScaleEventsPerReplica is events per minute one replica handles, replicas are scaled up
+	// proportionally to event rate of last minute. 0 means scale up to min replicas only
+	// +optional
+	ScaleEventsPerReplica int32 `json:"scaleEventsPerReplica,omitempty" protobuf:"varint,9,opt,name=scaleEventsPerReplica"`
+	// ScaleDownCooldown is seconds between two scale down steps, each step halves replicas above desired.
+	// Defaults to 60
+	// +optional
+	ScaleDownCooldown int32 `json:"scaleDownCooldown,omitempty" protobuf:"varint,10,opt,name=scaleDownCooldown"`
+	// ScaleDownGracePeriod is max seconds scale down is deferred while requests proxied by trigger are in flight.
+	// Defaults to 300
+	// +optional
+	ScaleDownGracePeriod int32 `json:"scaleDownGracePeriod,omitempty" protobuf:"varint,11,opt,name=scaleDownGracePeriod"`
 }
 
+// ScaleDownMode is where scale operation scales down to while idle
+type ScaleDownMode string
+
+const (
+	ScaleDownToZero ScaleDownMode = "zero"
+	ScaleDownToMin  ScaleDownMode = "min"
+)
+
 type HTTPActor struct {
 	// URL refers to the URL to send HTTP request to.
 	URL string `json:"url" protobuf:"bytes,1,opt,name=url"`
@@ -0,0 +1,124 @@
+package v1
+
+// DedupKeyType is where the deduplication key of an event comes from
+type DedupKeyType string
+
+// possible values for DedupKeyType
+const (
+	DedupUUIDKey     DedupKeyType = "uuid"     // event uuid, e.g. EVENTRIGGER_UUID header of http trigger
+	DedupMessageKey  DedupKeyType = "key"      // message key of source, e.g. kafka message key
+	DedupJSONPathKey DedupKeyType = "jsonpath" // jsonpath expression evaluated over event data
+)
+
+// DedupBackendType is where seen deduplication keys are stored
+type DedupBackendType string
+
+// possible values for DedupBackendType
+const (
+	DedupMemoryBackend    DedupBackendType = "memory"
+	DedupConfigMapBackend DedupBackendType = "configmap"
+	DedupRedisBackend     DedupBackendType = "redis"
+)
+
+// Deduplication drops events whose key has already been seen within the window,
+// duplicate events are acknowledged but do not exec the actor.
+type Deduplication struct {
+	// Key is where the deduplication key comes from.
+	// Default value is uuid.
+	// +optional
+	Key DedupKeyType `json:"key,omitempty" protobuf:"bytes,1,opt,name=key,casttype=DedupKeyType"`
+	// JSONPath is the expression evaluated over event data while key is jsonpath, e.g. "{.id}"
+	// +optional
+	JSONPath string `json:"jsonPath,omitempty" protobuf:"bytes,2,opt,name=jsonPath"`
+	// TTLSeconds is the deduplication window in second.
+	// Default value is 300 seconds.
+	// +optional
+	TTLSeconds int32 `json:"ttlSeconds,omitempty" protobuf:"varint,3,opt,name=ttlSeconds"`
+	// Backend is where seen keys are stored, shared backends keep the window across operator restarts.
+	// Default value is memory.
+	// +optional
+	Backend DedupBackendType `json:"backend,omitempty" protobuf:"bytes,4,opt,name=backend,casttype=DedupBackendType"`
+	// Meta is the options of backend, e.g. name of configmap, addr/password/db of redis
+	// +optional
+	Meta map[string]string `json:"meta,omitempty" protobuf:"bytes,5,rep,name=meta"`
+}
+
+// FlowControlPolicy is how events exceeding flow control are handled
+type FlowControlPolicy string
+
+// possible values for FlowControlPolicy
+const (
+	FlowDropPolicy     FlowControlPolicy = "drop"     // drop excess events
+	FlowCoalescePolicy FlowControlPolicy = "coalesce" // keep the last excess event and fire it once allowed
+)
+
+// RateLimit is a token bucket which refills Requests tokens every PeriodSeconds
+type RateLimit struct {
+	// Requests is the number of events allowed every period
+	Requests int32 `json:"requests" protobuf:"varint,1,opt,name=requests"`
+	// PeriodSeconds is the period of rate limit.
+	// Default value is 1 second.
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty" protobuf:"varint,2,opt,name=periodSeconds"`
+	// Burst is the size of bucket.
+	// Default value is Requests.
+	// +optional
+	Burst int32 `json:"burst,omitempty" protobuf:"varint,3,opt,name=burst"`
+}
+
+// FlowControl limits how often the actor is executed by events
+type FlowControl struct {
+	// RateLimit is a token bucket rate limit of events
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty" protobuf:"bytes,1,opt,name=rateLimit"`
+	// DebounceSeconds fires once with the last event after DebounceSeconds of quiet
+	// +optional
+	DebounceSeconds int32 `json:"debounceSeconds,omitempty" protobuf:"varint,2,opt,name=debounceSeconds"`
+	// ThrottleSeconds fires at most once every ThrottleSeconds
+	// +optional
+	ThrottleSeconds int32 `json:"throttleSeconds,omitempty" protobuf:"varint,3,opt,name=throttleSeconds"`
+	// Policy is how events exceeding rate limit or throttle are handled.
+	// Default value is drop.
+	// +optional
+	Policy FlowControlPolicy `json:"policy,omitempty" protobuf:"bytes,4,opt,name=policy,casttype=FlowControlPolicy"`
+}
+
+// Batching collects events into one batch event before the actor, a batch is fired once any window is reached.
+// Data of batch event is a json array of member events.
+type Batching struct {
+	// Count fires batch once it has Count events
+	// +optional
+	Count int32 `json:"count,omitempty" protobuf:"varint,1,opt,name=count"`
+	// WindowSeconds fires batch WindowSeconds after its first event
+	// +optional
+	WindowSeconds int32 `json:"windowSeconds,omitempty" protobuf:"varint,2,opt,name=windowSeconds"`
+	// MaxBytes fires batch before data of its events exceeds MaxBytes
+	// +optional
+	MaxBytes int32 `json:"maxBytes,omitempty" protobuf:"varint,3,opt,name=maxBytes"`
+}
+
+// PartitionKeyType is which key of event decides the worker it is executed by
+type PartitionKeyType string
+
+// possible values for PartitionKeyType
+const (
+	PartitionBySource PartitionKeyType = "source" // event source, e.g. kafka or mqtt topic
+	PartitionByKey    PartitionKeyType = "key"    // message key of source, e.g. kafka message key, falls back to source
+	PartitionByType   PartitionKeyType = "type"   // event type
+)
+
+// Workers executes the actor concurrently, events with the same partition key are executed in order
+type Workers struct {
+	// Count is the number of workers.
+	// Default value is 1.
+	// +optional
+	Count int32 `json:"count,omitempty" protobuf:"varint,1,opt,name=count"`
+	// PartitionKey decides the worker of event.
+	// Default value is source.
+	// +optional
+	PartitionKey PartitionKeyType `json:"partitionKey,omitempty" protobuf:"bytes,2,opt,name=partitionKey,casttype=PartitionKeyType"`
+	// QueueSize is the number of events buffered by each worker, events of a full queue are dropped.
+	// Default value is 64.
+	// +optional
+	QueueSize int32 `json:"queueSize,omitempty" protobuf:"varint,3,opt,name=queueSize"`
+}
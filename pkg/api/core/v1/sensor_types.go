@@ -54,6 +54,19 @@ type SensorSpec struct {
 	Actor Actor `json:"actor" protobuf:"bytes,2,rep,name=actor" yaml:"actor"`
 
 	Target Target `json:"target" protobuf:"bytes,3,rep,name=target" yaml:"target"`
+
+	// Dedup drops duplicate events before the actor
+	// +optional
+	Dedup *Deduplication `json:"dedup,omitempty" protobuf:"bytes,4,opt,name=dedup" yaml:"dedup"`
+	// FlowControl rate limits, debounces or throttles events before the actor
+	// +optional
+	FlowControl *FlowControl `json:"flowControl,omitempty" protobuf:"bytes,5,opt,name=flowControl" yaml:"flowControl"`
+	// Batch aggregates events by count, time or size windows before the actor
+	// +optional
+	Batch *Batching `json:"batch,omitempty" protobuf:"bytes,6,opt,name=batch" yaml:"batch"`
+	// Workers executes the actor concurrently while keeping order of events with the same key
+	// +optional
+	Workers *Workers `json:"workers,omitempty" protobuf:"bytes,7,opt,name=workers" yaml:"workers"`
 }
 
 // SensorStatus defines the observed state of Sensor
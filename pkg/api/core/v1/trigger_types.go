@@ -3,14 +3,18 @@ package v1
 type TriggerType string
 
 var (
-	MQTTTriggerType        TriggerType = "mqtt"
-	RedisTriggerType       TriggerType = "redis"
-	CronTriggerType        TriggerType = "cron"
-	KafkaTriggerType       TriggerType = "kafka"
-	HttpTriggerType        TriggerType = "http"
-	K8sHttpTriggerType     TriggerType = "k8s_http"
-	CloudEventsTriggerType TriggerType = "cloud_events"
-	K8sEventsTriggerType   TriggerType = "k8s_events"
+	MQTTTriggerType         TriggerType = "mqtt"
+	RedisTriggerType        TriggerType = "redis"
+	CronTriggerType         TriggerType = "cron"
+	KafkaTriggerType        TriggerType = "kafka"
+	HttpTriggerType         TriggerType = "http"
+	K8sHttpTriggerType      TriggerType = "k8s_http"
+	CloudEventsTriggerType  TriggerType = "cloud_events"
+	K8sEventsTriggerType    TriggerType = "k8s_events"
+	GitTriggerType          TriggerType = "git"
+	RegistryTriggerType     TriggerType = "registry"
+	AlertmanagerTriggerType TriggerType = "alertmanager"
+	K8sWatchTriggerType     TriggerType = "k8s_watch"
 )
 
 // Trigger common monitor which can produce events to trigger K8S resource.
@@ -117,6 +117,21 @@ func (in *ArtifactLocation) DeepCopy() *ArtifactLocation {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Batching) DeepCopyInto(out *Batching) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Batching.
+func (in *Batching) DeepCopy() *Batching {
+	if in == nil {
+		return nil
+	}
+	out := new(Batching)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudEventsTarget) DeepCopyInto(out *CloudEventsTarget) {
 	*out = *in
@@ -162,6 +177,28 @@ func (in *CronTrigger) DeepCopy() *CronTrigger {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Deduplication) DeepCopyInto(out *Deduplication) {
+	*out = *in
+	if in.Meta != nil {
+		in, out := &in.Meta, &out.Meta
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Deduplication.
+func (in *Deduplication) DeepCopy() *Deduplication {
+	if in == nil {
+		return nil
+	}
+	out := new(Deduplication)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FileArtifact) DeepCopyInto(out *FileArtifact) {
 	*out = *in
@@ -177,6 +214,26 @@ func (in *FileArtifact) DeepCopy() *FileArtifact {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlowControl) DeepCopyInto(out *FlowControl) {
+	*out = *in
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(RateLimit)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlowControl.
+func (in *FlowControl) DeepCopy() *FlowControl {
+	if in == nil {
+		return nil
+	}
+	out := new(FlowControl)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HTTPActor) DeepCopyInto(out *HTTPActor) {
 	*out = *in
@@ -355,6 +412,21 @@ func (in *MQTTTrigger) DeepCopy() *MQTTTrigger {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RateLimit) DeepCopyInto(out *RateLimit) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RateLimit.
+func (in *RateLimit) DeepCopy() *RateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(RateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RedisTarget) DeepCopyInto(out *RedisTarget) {
 	*out = *in
@@ -527,6 +599,26 @@ func (in *SensorSpec) DeepCopyInto(out *SensorSpec) {
 	in.Trigger.DeepCopyInto(&out.Trigger)
 	in.Actor.DeepCopyInto(&out.Actor)
 	in.Target.DeepCopyInto(&out.Target)
+	if in.Dedup != nil {
+		in, out := &in.Dedup, &out.Dedup
+		*out = new(Deduplication)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FlowControl != nil {
+		in, out := &in.FlowControl, &out.FlowControl
+		*out = new(FlowControl)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Batch != nil {
+		in, out := &in.Batch, &out.Batch
+		*out = new(Batching)
+		**out = **in
+	}
+	if in.Workers != nil {
+		in, out := &in.Workers, &out.Workers
+		*out = new(Workers)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SensorSpec.
@@ -653,3 +745,18 @@ func (in *URLArtifact) DeepCopy() *URLArtifact {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Workers) DeepCopyInto(out *Workers) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Workers.
+func (in *Workers) DeepCopy() *Workers {
+	if in == nil {
+		return nil
+	}
+	out := new(Workers)
+	in.DeepCopyInto(out)
+	return out
+}
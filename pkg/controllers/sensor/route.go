@@ -0,0 +1,223 @@
+package sensor
+
+import (
+	"context"
+	"eventrigger.com/operator/common/consts"
+	corev1 "eventrigger.com/operator/pkg/api/core/v1"
+	"fmt"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"strconv"
+	"strings"
+)
+
+var virtualServiceGVK = schema.GroupVersionKind{
+	Group:   "networking.istio.io",
+	Version: "v1beta1",
+	Kind:    "VirtualService",
+}
+
+// routes are hosts and path prefixes of http triggers, which are served by operator http service
+type routes struct {
+	Hosts []string
+	Paths []string
+}
+
+func sensorRoutes(sensor *corev1.Sensor) routes {
+	var r routes
+	switch corev1.TriggerType(sensor.Spec.Trigger.Type) {
+	case corev1.HttpTriggerType, corev1.K8sHttpTriggerType, corev1.GitTriggerType,
+		corev1.RegistryTriggerType, corev1.AlertmanagerTriggerType:
+	default:
+		return r
+	}
+	triggerMeta := sensor.Spec.Trigger.Meta
+	if hosts, ok := triggerMeta["hosts"]; ok && hosts != "" {
+		r.Hosts = strings.Split(hosts, ",")
+	}
+	if paths, ok := triggerMeta["paths"]; ok && paths != "" {
+		r.Paths = strings.Split(paths, ",")
+	}
+	if len(r.Paths) == 0 {
+		r.Paths = []string{"/"}
+	}
+	return r
+}
+
+func annotationEnabled(sensor *corev1.Sensor, key string) bool {
+	enabled, _ := strconv.ParseBool(sensor.Annotations[key])
+	return enabled
+}
+
+// routeName is name of ingress or virtual service from annotation, defaults to name of sensor
+func routeName(sensor *corev1.Sensor, key string) string {
+	if name := sensor.Annotations[key]; name != "" {
+		return name
+	}
+	return sensor.Name
+}
+
+// serviceHost is fqdn of operator http service
+func (r *SensorReconciler) serviceHost() string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", r.HttpService.Name, r.HttpService.Namespace)
+}
+
+// reconcileRoutes creates or updates ingress and virtual service of enabled annotations, disabled ones are deleted
+func (r *SensorReconciler) reconcileRoutes(ctx context.Context, sensor *corev1.Sensor) error {
+	rs := sensorRoutes(sensor)
+	ingressEnabled := annotationEnabled(sensor, consts.InjectIngressEnable) && len(rs.Hosts) > 0
+	istioEnabled := annotationEnabled(sensor, consts.InjectIstioEnable) && len(rs.Hosts) > 0
+	if (ingressEnabled || istioEnabled) && r.HttpService.Name == "" {
+		return errors.New("http service of operator is not set, cannot route hosts of sensor")
+	}
+
+	ingressName := routeName(sensor, consts.InjectIngressName)
+	if ingressEnabled {
+		if err := r.reconcileIngress(ctx, sensor, ingressName, rs); err != nil {
+			return errors.Wrapf(err, "reconcile ingress %s", ingressName)
+		}
+	} else {
+		if err := r.deleteOwned(ctx, sensor, &networkingv1.Ingress{}, ingressName); err != nil {
+			return errors.Wrapf(err, "delete ingress %s", ingressName)
+		}
+		if err := r.deleteOwned(ctx, sensor, &v1.Service{}, ingressName); err != nil {
+			return errors.Wrapf(err, "delete service %s", ingressName)
+		}
+	}
+
+	vsName := routeName(sensor, consts.InjectIstioVirtualService)
+	vs := &unstructured.Unstructured{}
+	vs.SetGroupVersionKind(virtualServiceGVK)
+	if istioEnabled {
+		if err := r.reconcileVirtualService(ctx, sensor, vs, vsName, rs); err != nil {
+			return errors.Wrapf(err, "reconcile virtual service %s", vsName)
+		}
+	} else if err := r.deleteOwned(ctx, sensor, vs, vsName); err != nil {
+		return errors.Wrapf(err, "delete virtual service %s", vsName)
+	}
+	return nil
+}
+
+// reconcileIngress routes hosts to operator http service. Backend of ingress must be in its namespace,
+// so an ExternalName service of the same name points to operator http service in other namespace.
+func (r *SensorReconciler) reconcileIngress(ctx context.Context, sensor *corev1.Sensor, name string, rs routes) error {
+	backendName := r.HttpService.Name
+	if sensor.Namespace != r.HttpService.Namespace {
+		backendName = name
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: sensor.Namespace}}
+		_, err := controllerutil.CreateOrUpdate(ctx, r.Client, svc, func() error {
+			svc.Spec.Type = v1.ServiceTypeExternalName
+			svc.Spec.ExternalName = r.serviceHost()
+			svc.Spec.Ports = []v1.ServicePort{{Name: "http", Port: r.HttpServicePort}}
+			return controllerutil.SetControllerReference(sensor, svc, r.Scheme)
+		})
+		if err != nil {
+			return errors.Wrap(err, "create or update external name service")
+		}
+	}
+
+	pathType := networkingv1.PathTypePrefix
+	paths := make([]networkingv1.HTTPIngressPath, 0, len(rs.Paths))
+	for _, p := range rs.Paths {
+		paths = append(paths, networkingv1.HTTPIngressPath{
+			Path:     p,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: backendName,
+					Port: networkingv1.ServiceBackendPort{Number: r.HttpServicePort},
+				},
+			},
+		})
+	}
+	rules := make([]networkingv1.IngressRule, 0, len(rs.Hosts))
+	for _, host := range rs.Hosts {
+		rules = append(rules, networkingv1.IngressRule{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths},
+			},
+		})
+	}
+
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: sensor.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, ingress, func() error {
+		ingress.Spec.Rules = rules
+		if class := sensor.Annotations[consts.InjectIngressClass]; class != "" {
+			ingress.Spec.IngressClassName = &class
+		} else {
+			ingress.Spec.IngressClassName = nil
+		}
+		return controllerutil.SetControllerReference(sensor, ingress, r.Scheme)
+	})
+	return err
+}
+
+// reconcileVirtualService routes hosts to operator http service through gateways of annotation, or mesh if none
+func (r *SensorReconciler) reconcileVirtualService(ctx context.Context, sensor *corev1.Sensor, vs *unstructured.Unstructured, name string, rs routes) error {
+	hosts := make([]interface{}, 0, len(rs.Hosts))
+	for _, host := range rs.Hosts {
+		hosts = append(hosts, host)
+	}
+	match := make([]interface{}, 0, len(rs.Paths))
+	for _, p := range rs.Paths {
+		match = append(match, map[string]interface{}{
+			"uri": map[string]interface{}{"prefix": p},
+		})
+	}
+	spec := map[string]interface{}{
+		"hosts": hosts,
+		"http": []interface{}{
+			map[string]interface{}{
+				"match": match,
+				"route": []interface{}{
+					map[string]interface{}{
+						"destination": map[string]interface{}{
+							"host": r.serviceHost(),
+							"port": map[string]interface{}{"number": int64(r.HttpServicePort)},
+						},
+					},
+				},
+			},
+		},
+	}
+	if gateways := sensor.Annotations[consts.InjectIstioGateway]; gateways != "" {
+		var gws []interface{}
+		for _, gw := range strings.Split(gateways, ",") {
+			gws = append(gws, gw)
+		}
+		spec["gateways"] = gws
+	}
+
+	vs.SetNamespace(sensor.Namespace)
+	vs.SetName(name)
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, vs, func() error {
+		vs.Object["spec"] = spec
+		return controllerutil.SetControllerReference(sensor, vs, r.Scheme)
+	})
+	return err
+}
+
+// deleteOwned deletes object of name controlled by sensor, objects created by others are kept
+func (r *SensorReconciler) deleteOwned(ctx context.Context, sensor *corev1.Sensor, obj client.Object, name string) error {
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: sensor.Namespace, Name: name}, obj)
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(obj, sensor) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Client.Delete(ctx, obj))
+}
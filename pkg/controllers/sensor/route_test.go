@@ -0,0 +1,88 @@
+package sensor
+
+import (
+	"context"
+	"eventrigger.com/operator/common/consts"
+	corev1 "eventrigger.com/operator/pkg/api/core/v1"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+func newRouteSensor(annotations map[string]string) *corev1.Sensor {
+	return &corev1.Sensor{
+		ObjectMeta: metav1.ObjectMeta{Name: "s", Namespace: "app", UID: "uid", Annotations: annotations},
+		Spec: corev1.SensorSpec{
+			Trigger: corev1.Trigger{
+				Type: string(corev1.K8sHttpTriggerType),
+				Meta: map[string]string{"hosts": "a.example.com,b.example.com", "paths": "/api"},
+			},
+		},
+	}
+}
+
+func TestSensorRoutes(t *testing.T) {
+	rs := sensorRoutes(newRouteSensor(nil))
+	assert.Equal(t, []string{"a.example.com", "b.example.com"}, rs.Hosts)
+	assert.Equal(t, []string{"/api"}, rs.Paths)
+
+	s := newRouteSensor(nil)
+	s.Spec.Trigger.Meta = map[string]string{"hosts": "a.example.com"}
+	assert.Equal(t, []string{"/"}, sensorRoutes(s).Paths)
+
+	s.Spec.Trigger.Type = string(corev1.KafkaTriggerType)
+	assert.Empty(t, sensorRoutes(s).Hosts)
+}
+
+func TestReconcileIngress(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, clientgoscheme.AddToScheme(scheme))
+	assert.Nil(t, corev1.AddToScheme(scheme))
+	r := &SensorReconciler{
+		Client:          fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme:          scheme,
+		HttpService:     types.NamespacedName{Namespace: "eventrigger", Name: "operator"},
+		HttpServicePort: 80,
+	}
+	ctx := context.Background()
+	s := newRouteSensor(map[string]string{
+		consts.InjectIngressEnable: "true",
+		consts.InjectIngressName:   "route",
+		consts.InjectIngressClass:  "nginx",
+	})
+	assert.Nil(t, r.reconcileRoutes(ctx, s))
+
+	ingress := &networkingv1.Ingress{}
+	assert.Nil(t, r.Client.Get(ctx, types.NamespacedName{Namespace: "app", Name: "route"}, ingress))
+	assert.Len(t, ingress.Spec.Rules, 2)
+	assert.Equal(t, "a.example.com", ingress.Spec.Rules[0].Host)
+	assert.Equal(t, "/api", ingress.Spec.Rules[0].HTTP.Paths[0].Path)
+	assert.Equal(t, "route", ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name)
+	assert.Equal(t, "nginx", *ingress.Spec.IngressClassName)
+	assert.True(t, metav1.IsControlledBy(ingress, s))
+
+	svc := &v1.Service{}
+	assert.Nil(t, r.Client.Get(ctx, types.NamespacedName{Namespace: "app", Name: "route"}, svc))
+	assert.Equal(t, v1.ServiceTypeExternalName, svc.Spec.Type)
+	assert.Equal(t, "operator.eventrigger.svc.cluster.local", svc.Spec.ExternalName)
+
+	s.Annotations[consts.InjectIngressEnable] = "false"
+	assert.Nil(t, r.reconcileRoutes(ctx, s))
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: "app", Name: "route"}, &networkingv1.Ingress{})
+	assert.True(t, apierrors.IsNotFound(err))
+	err = r.Client.Get(ctx, types.NamespacedName{Namespace: "app", Name: "route"}, &v1.Service{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// objects not controlled by sensor are kept
+	other := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "other"}}
+	assert.Nil(t, r.Client.Create(ctx, other))
+	assert.Nil(t, r.deleteOwned(ctx, s, &networkingv1.Ingress{}, "other"))
+	assert.Nil(t, r.Client.Get(ctx, types.NamespacedName{Namespace: "app", Name: "other"}, &networkingv1.Ingress{}))
+}
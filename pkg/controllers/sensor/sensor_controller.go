@@ -21,8 +21,11 @@ import (
 	corev1 "eventrigger.com/operator/pkg/api/core/v1"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -41,12 +44,18 @@ const (
 type SensorReconciler struct {
 	Client client.Client
 	Scheme *runtime.Scheme
-	logger *zap.SugaredLogger
+	// HttpService is operator http service, ingress and virtual service of sensors route hosts to it
+	HttpService     types.NamespacedName
+	HttpServicePort int32
+	logger          *zap.SugaredLogger
 }
 
 //+kubebuilder:rbac:groups=core.eventrigger.com,resources=sensors,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core.eventrigger.com,resources=sensors/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=core.eventrigger.com,resources=sensors/finalizers,verbs=update
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -59,6 +68,9 @@ type SensorReconciler struct {
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.10.0/pkg/reconcile
 func (r *SensorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
+	if r.logger == nil {
+		r.logger = zap.S().Named(ControllerName)
+	}
 
 	sensor := &corev1.Sensor{}
 	if err := r.Client.Get(ctx, req.NamespacedName, sensor); err != nil {
@@ -84,7 +96,6 @@ func (r *SensorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 
 // reconcile does the real logic
 func (r *SensorReconciler) reconcile(ctx context.Context, sensor *corev1.Sensor) error {
-	// todo: in sensor controller, auto add hosts if inject ingress enable
 	log := r.logger.With("namespace", sensor.Namespace).With("sensor", sensor.Name)
 	if sensor.DeletionTimestamp.IsZero() {
 		log.Info("adding sensor")
@@ -97,6 +108,9 @@ func (r *SensorReconciler) reconcile(ctx context.Context, sensor *corev1.Sensor)
 		if sensor.Status.Judgment.EventId == "" {
 			sensor.Status.Judgment.EventId = uuid.New().String()
 		}
+		if err := r.reconcileRoutes(ctx, sensor); err != nil {
+			return err
+		}
 	} else {
 		// The object is being deleted
 		if controllerutil.ContainsFinalizer(sensor, finalizerName) {
@@ -114,5 +128,7 @@ func (r *SensorReconciler) reconcile(ctx context.Context, sensor *corev1.Sensor)
 func (r *SensorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Sensor{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&v1.Service{}).
 		Complete(r)
 }
@@ -0,0 +1,74 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"eventrigger.com/operator/common/event"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"fmt"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/jsonpath"
+	"time"
+)
+
+const defaultTTLSeconds = 300
+
+type Interface interface {
+	// Seen records key and reports whether key has already been recorded within the window
+	Seen(ctx context.Context, key string) (bool, error)
+}
+
+// NewDeduplicator init backend of spec, namespace and name of sensor are used by shared backends
+func NewDeduplicator(spec *v1.Deduplication, namespace, name string) (Interface, error) {
+	if spec == nil {
+		return nil, errors.New("dedup spec is nil")
+	}
+	ttl := time.Duration(spec.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultTTLSeconds * time.Second
+	}
+	switch spec.Backend {
+	case "", v1.DedupMemoryBackend:
+		return NewMemoryDeduplicator(ttl), nil
+	case v1.DedupConfigMapBackend:
+		return NewConfigMapDeduplicator(spec.Meta, namespace, name, ttl)
+	case v1.DedupRedisBackend:
+		return NewRedisDeduplicator(spec.Meta, namespace, name, ttl)
+	default:
+		return nil, errors.New(fmt.Sprintf("not support dedup backend %s", spec.Backend))
+	}
+}
+
+// EventKey get deduplication key of event, empty key means event cannot be deduplicated
+func EventKey(spec *v1.Deduplication, e event.Event) (string, error) {
+	switch spec.Key {
+	case "", v1.DedupUUIDKey:
+		return e.UUID, nil
+	case v1.DedupMessageKey:
+		return e.Key, nil
+	case v1.DedupJSONPathKey:
+		return jsonPathValue(spec.JSONPath, e.Data)
+	default:
+		return "", errors.New(fmt.Sprintf("not support dedup key %s", spec.Key))
+	}
+}
+
+func jsonPathValue(expr, data string) (string, error) {
+	if expr == "" {
+		return "", errors.New("dedup jsonpath is empty")
+	}
+	var obj interface{}
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		return "", errors.Wrap(err, "event data is not json")
+	}
+	jp := jsonpath.New("dedup").AllowMissingKeys(true)
+	if err := jp.Parse(expr); err != nil {
+		return "", errors.Wrapf(err, "parse jsonpath %s", expr)
+	}
+	buf := &bytes.Buffer{}
+	if err := jp.Execute(buf, obj); err != nil {
+		return "", errors.Wrapf(err, "exec jsonpath %s", expr)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,97 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"eventrigger.com/operator/common/k8s"
+	"fmt"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"strconv"
+	"time"
+)
+
+// configMapDeduplicator keeps seen keys in data of a ConfigMap, key is sha1 of dedup key and
+// value is unix expire time. It suits low rate sensors since every event costs an update.
+type configMapDeduplicator struct {
+	Namespace string
+	Name      string
+	TTL       time.Duration
+	Cli       kubernetes.Interface
+}
+
+// NewConfigMapDeduplicator keeps keys in ConfigMap of namespace of sensor, other namespaces are rejected
+func NewConfigMapDeduplicator(meta map[string]string, namespace, name string, ttl time.Duration) (*configMapDeduplicator, error) {
+	if cmNamespace, ok := meta["namespace"]; ok && cmNamespace != "" && cmNamespace != namespace {
+		return nil, errors.New(fmt.Sprintf("dedup configmap of sensor in namespace %s cannot be in namespace %s", namespace, cmNamespace))
+	}
+	cfg, err := k8s.GetKubeConfig()
+	if err != nil {
+		return nil, err
+	}
+	cli, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "new k8s cli for configmap dedup")
+	}
+	d := &configMapDeduplicator{
+		Namespace: namespace,
+		Name:      fmt.Sprintf("%s-dedup", name),
+		TTL:       ttl,
+		Cli:       cli,
+	}
+	if cmName, ok := meta["name"]; ok && cmName != "" {
+		d.Name = cmName
+	}
+	return d, nil
+}
+
+func (d *configMapDeduplicator) Seen(ctx context.Context, key string) (seen bool, err error) {
+	sum := sha1.Sum([]byte(key))
+	dataKey := hex.EncodeToString(sum[:])
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		now := time.Now()
+		cm, err := d.Cli.CoreV1().ConfigMaps(d.Namespace).Get(ctx, d.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			seen = false
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: d.Name, Namespace: d.Namespace},
+				Data:       map[string]string{dataKey: strconv.FormatInt(now.Add(d.TTL).Unix(), 10)},
+			}
+			_, err = d.Cli.CoreV1().ConfigMaps(d.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(corev1.Resource("configmaps"), d.Name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		for k, v := range cm.Data {
+			expire, pErr := strconv.ParseInt(v, 10, 64)
+			if pErr != nil || expire <= now.Unix() {
+				delete(cm.Data, k)
+			}
+		}
+		if _, ok := cm.Data[dataKey]; ok {
+			seen = true
+			return nil
+		}
+		seen = false
+		cm.Data[dataKey] = strconv.FormatInt(now.Add(d.TTL).Unix(), 10)
+		_, err = d.Cli.CoreV1().ConfigMaps(d.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "dedup with configmap %s/%s", d.Namespace, d.Name)
+	}
+	return seen, nil
+}
@@ -0,0 +1,52 @@
+package dedup
+
+import (
+	"context"
+	"eventrigger.com/operator/common/event"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryDeduplicator(t *testing.T) {
+	ctx := context.Background()
+	d := NewMemoryDeduplicator(100 * time.Millisecond)
+
+	seen, err := d.Seen(ctx, "a")
+	assert.NoError(t, err)
+	assert.False(t, seen)
+	seen, _ = d.Seen(ctx, "a")
+	assert.True(t, seen)
+	seen, _ = d.Seen(ctx, "b")
+	assert.False(t, seen)
+
+	time.Sleep(150 * time.Millisecond)
+	seen, _ = d.Seen(ctx, "a")
+	assert.False(t, seen)
+}
+
+func TestEventKey(t *testing.T) {
+	e := event.NewEvent("", "kafka", "topic", "", `{"id": "order-1"}`, "uuid-1")
+	e.Key = "message-key"
+
+	key, err := EventKey(&v1.Deduplication{}, e)
+	assert.NoError(t, err)
+	assert.Equal(t, "uuid-1", key)
+
+	key, err = EventKey(&v1.Deduplication{Key: v1.DedupMessageKey}, e)
+	assert.NoError(t, err)
+	assert.Equal(t, "message-key", key)
+
+	key, err = EventKey(&v1.Deduplication{Key: v1.DedupJSONPathKey, JSONPath: "{.id}"}, e)
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", key)
+
+	_, err = EventKey(&v1.Deduplication{Key: v1.DedupJSONPathKey, JSONPath: "{.id}"}, event.NewSimpleEvent("", "", "not json"))
+	assert.Error(t, err)
+}
+
+func TestConfigMapDeduplicatorNamespace(t *testing.T) {
+	_, err := NewConfigMapDeduplicator(map[string]string{"namespace": "kube-system"}, "app", "s", time.Minute)
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package dedup
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryDeduplicator struct {
+	TTL time.Duration
+
+	mutex   sync.Mutex
+	expires map[string]time.Time
+	lastGC  time.Time
+}
+
+func NewMemoryDeduplicator(ttl time.Duration) *memoryDeduplicator {
+	return &memoryDeduplicator{
+		TTL:     ttl,
+		expires: make(map[string]time.Time),
+		lastGC:  time.Now(),
+	}
+}
+
+func (m *memoryDeduplicator) Seen(ctx context.Context, key string) (bool, error) {
+	now := time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// drop expired keys at most once a window
+	if now.Sub(m.lastGC) >= m.TTL {
+		for k, expire := range m.expires {
+			if !expire.After(now) {
+				delete(m.expires, k)
+			}
+		}
+		m.lastGC = now
+	}
+
+	if expire, ok := m.expires[key]; ok && expire.After(now) {
+		return true, nil
+	}
+	m.expires[key] = now.Add(m.TTL)
+	return false, nil
+}
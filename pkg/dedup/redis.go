@@ -0,0 +1,73 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"strconv"
+	"time"
+)
+
+type RedisOptions struct {
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	Prefix   string
+}
+
+type redisDeduplicator struct {
+	Opts *RedisOptions
+	TTL  time.Duration
+	Cli  *redis.Client
+}
+
+func parseRedisMeta(meta map[string]string) (opts *RedisOptions, err error) {
+	opts = &RedisOptions{}
+	m := make(map[string]string, len(meta))
+	for k, v := range meta {
+		m[k] = v
+	}
+	if db, ok := m["db"]; ok {
+		opts.DB, err = strconv.Atoi(db)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse meta db to int")
+		}
+		delete(m, "db")
+	}
+	err = mapstructure.Decode(m, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Addr == "" {
+		return nil, errors.New("redis dedup addr is empty")
+	}
+	return opts, nil
+}
+
+func NewRedisDeduplicator(meta map[string]string, namespace, name string, ttl time.Duration) (*redisDeduplicator, error) {
+	opts, err := parseRedisMeta(meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse redis dedup meta")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = fmt.Sprintf("eventrigger:dedup:%s/%s:", namespace, name)
+	}
+	cli := redis.NewClient(&redis.Options{
+		Addr:     opts.Addr,
+		Username: opts.Username,
+		Password: opts.Password,
+		DB:       opts.DB,
+	})
+	return &redisDeduplicator{Opts: opts, TTL: ttl, Cli: cli}, nil
+}
+
+func (r *redisDeduplicator) Seen(ctx context.Context, key string) (bool, error) {
+	set, err := r.Cli.SetNX(ctx, r.Opts.Prefix+key, time.Now().Unix(), r.TTL).Result()
+	if err != nil {
+		return false, errors.Wrapf(err, "redis setnx dedup key %s", key)
+	}
+	return !set, nil
+}
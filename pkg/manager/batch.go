@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"eventrigger.com/operator/common/event"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// batcher collects events into batch events once count, time or size window is reached,
+// batches reached by count or size are returned by Add, batches reached by time are sent to Ready.
+type batcher struct {
+	Spec    *v1.Batching
+	readyCh chan event.Event
+	stopCh  chan struct{}
+
+	mutex  sync.Mutex
+	events []event.Event
+	bytes  int
+	timer  *time.Timer
+}
+
+func newBatcher(spec *v1.Batching) (*batcher, error) {
+	if spec == nil {
+		return nil, errors.New("batch spec is nil")
+	}
+	if spec.Count <= 0 && spec.WindowSeconds <= 0 && spec.MaxBytes <= 0 {
+		return nil, errors.New("batch should have at least one of count, windowSeconds or maxBytes")
+	}
+	return &batcher{
+		Spec:    spec,
+		readyCh: make(chan event.Event),
+		stopCh:  make(chan struct{}),
+	}, nil
+}
+
+// Ready is the channel of batch events fired by time window
+func (b *batcher) Ready() <-chan event.Event {
+	return b.readyCh
+}
+
+// Add collects event and returns batches which reach count or size window
+func (b *batcher) Add(e event.Event) (batches []event.Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.Spec.MaxBytes > 0 && len(b.events) > 0 && b.bytes+len(e.Data) > int(b.Spec.MaxBytes) {
+		batches = appendBatch(batches, b.take())
+	}
+	b.events = append(b.events, e)
+	b.bytes += len(e.Data)
+	if (b.Spec.Count > 0 && len(b.events) >= int(b.Spec.Count)) ||
+		(b.Spec.MaxBytes > 0 && b.bytes >= int(b.Spec.MaxBytes)) {
+		return appendBatch(batches, b.take())
+	}
+	if b.Spec.WindowSeconds > 0 && b.timer == nil {
+		b.timer = time.AfterFunc(time.Duration(b.Spec.WindowSeconds)*time.Second, b.fireWindow)
+	}
+	return batches
+}
+
+func (b *batcher) fireWindow() {
+	b.mutex.Lock()
+	b.timer = nil
+	batch := b.take()
+	b.mutex.Unlock()
+	if batch == nil {
+		return
+	}
+	select {
+	case b.readyCh <- *batch:
+	case <-b.stopCh:
+	}
+}
+
+// take builds batch event of collected events and resets window, caller should hold the mutex
+func (b *batcher) take() *event.Event {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.events) == 0 {
+		return nil
+	}
+	count := len(b.events)
+	batch, err := event.NewBatchEvent(b.events)
+	b.events = nil
+	b.bytes = 0
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("drop batch of %d events", count), zap.Error(err))
+		return nil
+	}
+	zap.L().Info(fmt.Sprintf("fire batch of %d events", count))
+	return &batch
+}
+
+func appendBatch(batches []event.Event, batch *event.Event) []event.Event {
+	if batch == nil {
+		return batches
+	}
+	return append(batches, *batch)
+}
+
+// Stop drops events collected but not fired
+func (b *batcher) Stop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.events = nil
+	close(b.stopCh)
+}
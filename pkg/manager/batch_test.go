@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"encoding/json"
+	"eventrigger.com/operator/common/event"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBatchCountWindow(t *testing.T) {
+	b, err := newBatcher(&v1.Batching{Count: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, b.Add(event.NewSimpleEvent("test", "", "a")))
+	assert.Empty(t, b.Add(event.NewSimpleEvent("test", "", "b")))
+	batches := b.Add(event.NewSimpleEvent("test", "", "c"))
+	if assert.Len(t, batches, 1) {
+		var members []event.Event
+		assert.NoError(t, json.Unmarshal([]byte(batches[0].Data), &members))
+		assert.Len(t, members, 3)
+		assert.Equal(t, "a", members[0].Data)
+		assert.Equal(t, "test", batches[0].Type)
+	}
+}
+
+func TestBatchBytesWindow(t *testing.T) {
+	b, _ := newBatcher(&v1.Batching{MaxBytes: 5})
+	assert.Empty(t, b.Add(event.NewSimpleEvent("test", "", "abc")))
+	// flush abc before exceeding max bytes
+	assert.Len(t, b.Add(event.NewSimpleEvent("test", "", "def")), 1)
+	assert.Len(t, b.Add(event.NewSimpleEvent("test", "", "gh")), 1)
+}
+
+func TestBatchTimeWindow(t *testing.T) {
+	b, _ := newBatcher(&v1.Batching{WindowSeconds: 1})
+	defer b.Stop()
+	b.Add(event.NewSimpleEvent("test", "", "a"))
+	b.Add(event.NewSimpleEvent("test", "", "b"))
+	select {
+	case batch := <-b.Ready():
+		var members []event.Event
+		assert.NoError(t, json.Unmarshal([]byte(batch.Data), &members))
+		assert.Len(t, members, 2)
+	case <-time.After(2 * time.Second):
+		t.Fatal("batch is not fired by time window")
+	}
+}
@@ -0,0 +1,162 @@
+package manager
+
+import (
+	"eventrigger.com/operator/common/event"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+// flowController sits ahead of actor, events allowed by debounce, throttle and rate limit are sent to Ready
+type flowController struct {
+	Spec    *v1.FlowControl
+	Limiter *rate.Limiter
+	readyCh chan event.Event
+	count   func(result string)
+
+	mutex    sync.Mutex
+	lastFire time.Time
+	// debounce
+	debounceTimer *time.Timer
+	// coalesce
+	pending      *event.Event
+	pendingTimer *time.Timer
+	stopped      bool
+}
+
+func newFlowController(spec *v1.FlowControl, count func(result string)) (*flowController, error) {
+	if spec == nil {
+		return nil, errors.New("flow control spec is nil")
+	}
+	switch spec.Policy {
+	case "", v1.FlowDropPolicy, v1.FlowCoalescePolicy:
+	default:
+		return nil, errors.New(fmt.Sprintf("not support flow control policy %s", spec.Policy))
+	}
+	f := &flowController{
+		Spec:    spec,
+		readyCh: make(chan event.Event, 16),
+		count:   count,
+	}
+	if rl := spec.RateLimit; rl != nil {
+		if rl.Requests <= 0 {
+			return nil, errors.New("rate limit requests should be greater than 0")
+		}
+		period := rl.PeriodSeconds
+		if period <= 0 {
+			period = 1
+		}
+		burst := rl.Burst
+		if burst <= 0 {
+			burst = rl.Requests
+		}
+		f.Limiter = rate.NewLimiter(rate.Limit(float64(rl.Requests)/float64(period)), int(burst))
+	}
+	return f, nil
+}
+
+// Ready is the channel of events allowed to exec actor
+func (f *flowController) Ready() <-chan event.Event {
+	return f.readyCh
+}
+
+// Offer hands event to flow control, it never blocks
+func (f *flowController) Offer(e event.Event) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.stopped {
+		return
+	}
+	if f.Spec.DebounceSeconds > 0 {
+		if f.debounceTimer != nil && f.debounceTimer.Stop() {
+			f.count(eventCoalesced)
+		}
+		f.debounceTimer = time.AfterFunc(time.Duration(f.Spec.DebounceSeconds)*time.Second, func() {
+			f.mutex.Lock()
+			defer f.mutex.Unlock()
+			f.gate(e)
+		})
+		return
+	}
+	f.gate(e)
+}
+
+// gate applies throttle and rate limit, caller should hold the mutex
+func (f *flowController) gate(e event.Event) {
+	if f.stopped {
+		return
+	}
+	now := time.Now()
+	var wait time.Duration
+	if f.Spec.ThrottleSeconds > 0 && !f.lastFire.IsZero() {
+		wait = f.lastFire.Add(time.Duration(f.Spec.ThrottleSeconds) * time.Second).Sub(now)
+	}
+	if wait <= 0 && f.Limiter != nil {
+		r := f.Limiter.ReserveN(now, 1)
+		if !r.OK() {
+			wait = time.Second
+		} else if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			wait = delay
+		}
+	}
+	if wait > 0 {
+		f.hold(e, wait)
+		return
+	}
+	f.lastFire = now
+	f.emit(e)
+}
+
+// hold drops event or keeps it as the pending one fired after wait according to policy
+func (f *flowController) hold(e event.Event, wait time.Duration) {
+	if f.Spec.Policy != v1.FlowCoalescePolicy {
+		zap.L().Debug(fmt.Sprintf("flow control drop event %s-%s", e.Type, e.Source))
+		f.count(eventDropped)
+		return
+	}
+	if f.pending != nil {
+		f.count(eventCoalesced)
+	}
+	f.pending = &e
+	if f.pendingTimer != nil {
+		return
+	}
+	f.pendingTimer = time.AfterFunc(wait, func() {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		pending := f.pending
+		f.pending = nil
+		f.pendingTimer = nil
+		if pending != nil {
+			f.gate(*pending)
+		}
+	})
+}
+
+func (f *flowController) emit(e event.Event) {
+	select {
+	case f.readyCh <- e:
+	default:
+		zap.L().Warn(fmt.Sprintf("flow control ready queue is full, drop event %s-%s", e.Type, e.Source))
+		f.count(eventDropped)
+	}
+}
+
+// Stop cancels debounced and pending events
+func (f *flowController) Stop() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.stopped = true
+	if f.debounceTimer != nil {
+		f.debounceTimer.Stop()
+	}
+	if f.pendingTimer != nil {
+		f.pendingTimer.Stop()
+	}
+	f.pending = nil
+}
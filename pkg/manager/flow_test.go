@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"eventrigger.com/operator/common/event"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func drainReady(f *flowController, wait time.Duration) (events []event.Event) {
+	timeout := time.After(wait)
+	for {
+		select {
+		case e := <-f.Ready():
+			events = append(events, e)
+		case <-timeout:
+			return events
+		}
+	}
+}
+
+func newTestFlow(t *testing.T, spec *v1.FlowControl) (*flowController, map[string]int) {
+	counts := map[string]int{}
+	f, err := newFlowController(spec, func(result string) { counts[result]++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, counts
+}
+
+func TestFlowRateLimitDrop(t *testing.T) {
+	f, counts := newTestFlow(t, &v1.FlowControl{RateLimit: &v1.RateLimit{Requests: 2, PeriodSeconds: 10}})
+	for i := 0; i < 5; i++ {
+		f.Offer(event.NewSimpleEvent("test", "", strconv.Itoa(i)))
+	}
+	events := drainReady(f, 100*time.Millisecond)
+	assert.Len(t, events, 2)
+	assert.Equal(t, 3, counts[eventDropped])
+}
+
+func TestFlowThrottleCoalesce(t *testing.T) {
+	f, _ := newTestFlow(t, &v1.FlowControl{ThrottleSeconds: 1, Policy: v1.FlowCoalescePolicy})
+	for i := 0; i < 3; i++ {
+		f.Offer(event.NewSimpleEvent("test", "", strconv.Itoa(i)))
+	}
+	events := drainReady(f, 1500*time.Millisecond)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "0", events[0].Data)
+		assert.Equal(t, "2", events[1].Data)
+	}
+}
+
+func TestFlowDebounce(t *testing.T) {
+	f, _ := newTestFlow(t, &v1.FlowControl{DebounceSeconds: 1})
+	for i := 0; i < 3; i++ {
+		f.Offer(event.NewSimpleEvent("test", "", strconv.Itoa(i)))
+		time.Sleep(100 * time.Millisecond)
+	}
+	events := drainReady(f, 1500*time.Millisecond)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "2", events[0].Data)
+	}
+	f.Stop()
+}
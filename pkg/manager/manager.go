@@ -23,7 +23,9 @@ import (
 	"eventrigger.com/operator/common/sync/errsgroup"
 	"eventrigger.com/operator/pkg/generated/clientset/versioned"
 	"eventrigger.com/operator/pkg/generated/informers/externalversions"
+	"eventrigger.com/operator/pkg/trigger"
 	"github.com/google/go-cmp/cmp"
+	"github.com/panjf2000/ants/v2"
 	"k8s.io/client-go/tools/clientcmd"
 	"os"
 	"sync"
@@ -47,6 +49,7 @@ import (
 
 	"eventrigger.com/operator/pkg/controllers/sensor"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -73,6 +76,21 @@ type OperatorOptions struct {
 	HealthPort  int
 	LeaderElect bool
 	Debug       bool
+	// ActorConcurrency caps concurrent actor executions of all sensors, 0 means no cap
+	ActorConcurrency int
+	// CrossNamespaceWatch allows k8s_watch and k8s_events triggers to watch other namespaces than namespace of sensor
+	CrossNamespaceWatch bool
+	// HttpService is namespace/name of operator http service, ingress and virtual service of sensors route to it
+	HttpService     string
+	HttpServicePort int
+	// TLSPort serves k8s_http hosts with certificates of secrets by sni, 0 means disabled
+	TLSPort     int
+	TLSCertFile string
+	TLSKeyFile  string
+	// ExternalMetricsPort serves external.metrics.k8s.io api for hpa, 0 means disabled
+	ExternalMetricsPort     int
+	ExternalMetricsCertFile string
+	ExternalMetricsKeyFile  string
 	// event
 	CloudEventsPort uint `json:"cloud_events_port" yaml:"cloud_events_port"`
 
@@ -88,6 +106,9 @@ type Operator struct {
 	// map
 	RunnerChannelMap map[string]RunnerInterface
 
+	// ActorPool caps concurrent actor executions of all runners
+	ActorPool *ants.Pool
+
 	// controller
 	ErrorGroup errsgroup.Group
 	WaitGroup  sync.WaitGroup
@@ -125,6 +146,14 @@ func NewOperator(options *OperatorOptions) (op *Operator, err error) {
 		Workqueue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), consts.SensorName),
 	}
 
+	trigger.AllowCrossNamespaceWatch = op.Options.CrossNamespaceWatch
+	if op.Options.ActorConcurrency > 0 {
+		op.ActorPool, err = ants.NewPool(op.Options.ActorConcurrency)
+		if err != nil {
+			return nil, errors.Wrap(err, "init actor pool")
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     fmt.Sprintf(":%d", op.Options.MetricsPort),
@@ -137,10 +166,19 @@ func NewOperator(options *OperatorOptions) (op *Operator, err error) {
 		return nil, errors.Wrap(err, "init manager")
 	}
 
-	if err = (&sensor.SensorReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	reconciler := &sensor.SensorReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		HttpServicePort: int32(op.Options.HttpServicePort),
+	}
+	if op.Options.HttpService != "" {
+		namespace, name, err := cache.SplitMetaNamespaceKey(op.Options.HttpService)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse http service %s", op.Options.HttpService)
+		}
+		reconciler.HttpService = types.NamespacedName{Namespace: namespace, Name: name}
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		return nil, errors.Wrap(err, "unable to create controller Sensor")
 	}
 
@@ -201,15 +239,18 @@ func (op *Operator) AddSensorHandler(obj interface{}) {
 		return
 	}
 
-	r, err := NewRunner(object)
+	r, err := NewRunner(object, op.ActorPool)
 	if err != nil {
 		err = errors.Wrap(err, "init runner")
 		zap.L().Error(err.Error())
 		return
 	}
 	op.RunnerChannelMap[key] = r
+	// secrets of tls hosts and credentials of sensor are cached while it runs
+	server.GlobalSecretCache.Watch(object.Namespace)
 	op.ErrorGroup.Go(func() error {
 		defer delete(op.RunnerChannelMap, key)
+		defer server.GlobalSecretCache.Unwatch(object.Namespace)
 		err = r.Run()
 		if err != nil {
 			err = errors.Wrap(err, "run runner")
@@ -233,7 +274,8 @@ func (op *Operator) UpdateSensorHandler(oldObj, newObj interface{}) {
 		zap.L().Error("decode new k8s unstructured")
 		return
 	}
-	if cmp.Equal(oldObject, newObject) {
+	// status is updated by sensor controller, runner is only restarted once spec changes
+	if cmp.Equal(oldObject.Spec, newObject.Spec) {
 		zap.L().Debug("old obj and new obj spec is same")
 		return
 	}
@@ -277,10 +319,17 @@ func (op *Operator) Run() error {
 	undo := zap.ReplaceGlobals(logger)
 	defer undo()
 
+	// secrets of tls hosts and trigger credentials must be readable before serving
+	if err := server.GlobalSecretCache.Start(op.CTX); err != nil {
+		zap.L().Error("start secret cache", zap.Error(err))
+		return err
+	}
+
 	/* global server resource
 	GlobalHttpServer every k8s_http request will proxy
 	GlobalCloudEventsServer receive cloud events and filter event
-	GlobalK8sEventsMonitor listener filter
+	GlobalExternalMetricsServer serves sensor metrics to hpa
+	GlobalK8sEventsMonitor is started by k8s_events triggers
 	*/
 	op.ErrorGroup.Go(func() error {
 		return server.GlobalHttpServer.Run(fmt.Sprintf(":%d", op.Options.Port))
@@ -288,12 +337,20 @@ func (op *Operator) Run() error {
 	op.ErrorGroup.Go(func() error {
 		return server.GlobalCloudEventsServer.Run(fmt.Sprintf(":%d", op.Options.CloudEventsPort))
 	})
+	if op.Options.TLSPort > 0 {
+		op.ErrorGroup.Go(func() error {
+			return server.GlobalHttpServer.RunTLS(fmt.Sprintf(":%d", op.Options.TLSPort),
+				op.Options.TLSCertFile, op.Options.TLSKeyFile)
+		})
+	}
+	if op.Options.ExternalMetricsPort > 0 {
+		op.ErrorGroup.Go(func() error {
+			return server.GlobalExternalMetricsServer.Run(op.CTX, fmt.Sprintf(":%d", op.Options.ExternalMetricsPort),
+				op.Options.ExternalMetricsCertFile, op.Options.ExternalMetricsKeyFile)
+		})
+	}
 	op.ErrorGroup.Go(func() error {
-		server.GlobalK8sEventsMonitor, err = server.NewK8sEventsMonitor()
-		if err != nil {
-			return errors.Wrap(err, "cannot parse k8s events monitor")
-		}
-		return server.GlobalK8sEventsMonitor.Run()
+		return (*op.Controller).Start(op.CTX)
 	})
 
 	zap.L().Info("Starting workers")
@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"eventrigger.com/operator/common/server"
+	"eventrigger.com/operator/pkg/trigger"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// externalMetricsInterval is how often runner publishes metrics to external metrics server
+const externalMetricsInterval = 15 * time.Second
+
+// results of event in runner
+const (
+	eventReceived  = "received"
+	eventDuplicate = "duplicate"
+	eventDropped   = "dropped"
+	eventCoalesced = "coalesced"
+	eventExecuted  = "executed"
+	eventFailed    = "failed"
+)
+
+var (
+	sensorEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "eventrigger_sensor_events_total",
+		Help: "Number of events handled by sensor runner, partitioned by result",
+	}, []string{"namespace", "sensor", "result"})
+)
+
+func init() {
+	// served by metrics endpoint of controller manager
+	metrics.Registry.MustRegister(sensorEventsTotal)
+}
+
+func (r *runner) countEvent(result string) {
+	if result == eventReceived {
+		atomic.AddInt64(&r.received, 1)
+	}
+	sensorEventsTotal.WithLabelValues(r.Sensor.Namespace, r.Sensor.Name, result).Inc()
+}
+
+// publishMetrics sets event rate, queue depth and in flight requests of sensor to external metrics server
+func (r *runner) publishMetrics(interval time.Duration) {
+	ns, name := r.Sensor.Namespace, r.Sensor.Name
+	received := atomic.SwapInt64(&r.received, 0)
+	server.GlobalExternalMetricsServer.SetMetric(ns, name, server.MetricEventRate, float64(received)/interval.Seconds())
+
+	depth := len(r.eventCh)
+	if r.Workers != nil {
+		depth += r.Workers.Len()
+	}
+	server.GlobalExternalMetricsServer.SetMetric(ns, name, server.MetricQueueDepth, float64(depth))
+
+	if t, ok := r.Trigger.(trigger.InFlightInterface); ok {
+		server.GlobalExternalMetricsServer.SetMetric(ns, name, server.MetricHttpInFlight, float64(t.InFlight()))
+	}
+}
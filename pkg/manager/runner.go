@@ -4,12 +4,15 @@ import (
 	"context"
 	"eventrigger.com/operator/common/consts"
 	"eventrigger.com/operator/common/event"
+	"eventrigger.com/operator/common/server"
 	"eventrigger.com/operator/pkg/actor"
 	"eventrigger.com/operator/pkg/actor/k8s"
 	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"eventrigger.com/operator/pkg/dedup"
 	"eventrigger.com/operator/pkg/target"
 	"eventrigger.com/operator/pkg/trigger"
 	"fmt"
+	"github.com/panjf2000/ants/v2"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"strconv"
@@ -17,6 +20,13 @@ import (
 	"time"
 )
 
+const (
+	// scaleCheckInterval is how often scale operation checks to scale down
+	scaleCheckInterval = 10 * time.Second
+	// defaultScaleDownGracePeriod is max time scale down is deferred by in flight requests
+	defaultScaleDownGracePeriod = 300 * time.Second
+)
+
 type RunnerInterface interface {
 	Run() error
 	Stop()
@@ -31,6 +41,12 @@ type runner struct {
 	Trigger trigger.Interface
 	Actor   actor.Interface
 	Target  target.Interface
+	Dedup   dedup.Interface
+	Flow    *flowController
+	Batch   *batcher
+	Workers *workerPool
+	// Pool caps concurrent actor executions of all runners
+	Pool *ants.Pool
 	// Config
 	IdleTime time.Duration
 
@@ -38,10 +54,17 @@ type runner struct {
 	EventMutex sync.Mutex
 	EventCount int64
 	EventLast  time.Time
+	// events received since metrics are published
+	received int64
+	// last event persisted by actor, runner start is persisted if nothing is restored
+	savedLast time.Time
+	// since when requests have been in flight without drained
+	busySince time.Time
 }
 
-func ParseSensorTrigger(spec *v1.SensorSpec) (source trigger.Interface, err error) {
-	if spec == nil || len(spec.Trigger.Meta) == 0 {
+func ParseSensorTrigger(sensor *v1.Sensor) (source trigger.Interface, err error) {
+	spec := &sensor.Spec
+	if len(spec.Trigger.Meta) == 0 {
 		return nil, errors.New(fmt.Sprintf("sensor %+v trigger or meta is nil", spec))
 	}
 	m := spec.Trigger
@@ -55,9 +78,19 @@ func ParseSensorTrigger(spec *v1.SensorSpec) (source trigger.Interface, err erro
 	case string(v1.RedisMonitorType):
 		return trigger.NewRedisMonitor(m.Meta)
 	case string(v1.K8sEventsTriggerType):
-		return trigger.NewK8sEventsTrigger(m.Meta)
+		return trigger.NewK8sEventsTrigger(m.Meta, sensor.Namespace)
+	case string(v1.K8sWatchTriggerType):
+		return trigger.NewK8sWatchTrigger(m.Meta, sensor.Namespace)
 	case string(v1.CloudEventsTriggerType):
 		return trigger.NewCloudEventsTrigger(m.Meta)
+	case string(v1.HttpTriggerType):
+		return trigger.NewHttpMonitor(m.Meta, sensor.Namespace)
+	case string(v1.GitTriggerType):
+		return trigger.NewGitTrigger(m.Meta, sensor.Namespace)
+	case string(v1.RegistryTriggerType):
+		return trigger.NewRegistryTrigger(m.Meta, sensor.Namespace)
+	case string(v1.AlertmanagerTriggerType):
+		return trigger.NewAlertmanagerTrigger(m.Meta, sensor.Namespace)
 	case string(v1.K8sHttpTriggerType):
 		if spec.Actor.Template == nil {
 			return nil, errors.New("trigger cannot be nil while using k8s http monitor")
@@ -65,22 +98,27 @@ func ParseSensorTrigger(spec *v1.SensorSpec) (source trigger.Interface, err erro
 		if spec.Actor.Template.K8s == nil {
 			return nil, errors.New("k8s trigger cannot be nil while using k8s http monitor")
 		}
-		return trigger.NewK8sHttpTrigger(m.Meta, &spec.Actor)
+		return trigger.NewK8sHttpTrigger(m.Meta, &spec.Actor, sensor.Namespace)
 	default:
 		return nil, errors.New(fmt.Sprintf("not support monitor of %s", m.Type))
 	}
 }
 
-func ParseSensorActor(spec *v1.SensorSpec) (actor actor.Interface, err error) {
-	if spec == nil || spec.Actor.Template == nil {
+func ParseSensorActor(sensor *v1.Sensor) (actor actor.Interface, err error) {
+	if sensor == nil || sensor.Spec.Actor.Template == nil {
 		return nil, errors.New("actor template is nil")
 	}
-	a := spec.Actor
+	a := sensor.Spec.Actor
 	if a.Template.K8s != nil {
 		if a.Template.K8s.Source == nil {
 			return nil, errors.New("init k8s actor failed, source is nil")
 		}
-		return k8s.NewK8SActor(a.Template.K8s)
+		act, err := k8s.NewK8SActor(a.Template.K8s)
+		if err != nil {
+			return nil, err
+		}
+		act.ScaleByHPA = scaleByHPA(sensor)
+		return act, nil
 	}
 
 	if a.Template.HTTP != nil {
@@ -105,16 +143,24 @@ func ParseSensorTarget(spec *v1.SensorSpec) (tar target.Interface, err error) {
 	}
 }
 
-func NewRunner(sensor *v1.Sensor) (r RunnerInterface, err error) {
+func ParseSensorDedup(sensor *v1.Sensor) (d dedup.Interface, err error) {
+	if sensor.Spec.Dedup == nil {
+		return nil, nil
+	}
+	return dedup.NewDeduplicator(sensor.Spec.Dedup, sensor.Namespace, sensor.Name)
+}
+
+// NewRunner init runner of sensor, actor executions are submitted to pool if it is not nil
+func NewRunner(sensor *v1.Sensor, pool *ants.Pool) (r RunnerInterface, err error) {
 	ctx := context.Background()
 	if sensor == nil {
 		return nil, errors.New("sensor is nil, runner failed")
 	}
-	tri, err := ParseSensorTrigger(&sensor.Spec)
+	tri, err := ParseSensorTrigger(sensor)
 	if err != nil {
 		return nil, errors.Wrapf(err, "parse sensor %s/%s trigger", sensor.Name, sensor.Namespace)
 	}
-	act, err := ParseSensorActor(&sensor.Spec)
+	act, err := ParseSensorActor(sensor)
 	if err != nil {
 		return nil, errors.Wrapf(err, "parse sensor %s/%s actor", sensor.Name, sensor.Namespace)
 	}
@@ -122,19 +168,48 @@ func NewRunner(sensor *v1.Sensor) (r RunnerInterface, err error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "parse sensor %s/%s target", sensor.Name, sensor.Namespace)
 	}
+	dup, err := ParseSensorDedup(sensor)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse sensor %s/%s dedup", sensor.Name, sensor.Namespace)
+	}
 
-	r = &runner{
+	run := &runner{
 		CTX:        ctx,
 		Trigger:    tri,
 		Actor:      act,
 		Target:     tar,
+		Dedup:      dup,
 		Sensor:     sensor,
+		Pool:       pool,
 		EventLast:  time.Now(),
 		eventCh:    make(chan event.Event, 2),
 		stopCh:     make(chan struct{}, 2),
 		EventMutex: sync.Mutex{},
 	}
-	return r, nil
+	if sensor.Spec.FlowControl != nil {
+		run.Flow, err = newFlowController(sensor.Spec.FlowControl, run.countEvent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse sensor %s/%s flow control", sensor.Name, sensor.Namespace)
+		}
+	}
+	if sensor.Spec.Batch != nil {
+		run.Batch, err = newBatcher(sensor.Spec.Batch)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse sensor %s/%s batch", sensor.Name, sensor.Namespace)
+		}
+	}
+	if m, ok := tri.(trigger.MetricInterface); ok && m.MetricEnabled() {
+		if _, ok := act.(actor.ScaleInterface); !ok {
+			return nil, errors.New(fmt.Sprintf("sensor %s/%s trigger scales by metric but actor cannot scale", sensor.Name, sensor.Namespace))
+		}
+	}
+	if sensor.Spec.Workers != nil {
+		run.Workers, err = newWorkerPool(sensor.Spec.Workers, run.execActor)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse sensor %s/%s workers", sensor.Name, sensor.Namespace)
+		}
+	}
+	return run, nil
 }
 
 func (r *runner) Run() error {
@@ -143,59 +218,341 @@ func (r *runner) Run() error {
 		return err
 	}
 
+	if r.Workers != nil {
+		r.Workers.Start()
+	}
+
+	// triggers scale actor by metric, e.g. kafka lag
+	var metricCh <-chan time.Time
+	metricTrigger, metricEnabled := r.Trigger.(trigger.MetricInterface)
+	metricEnabled = metricEnabled && metricTrigger.MetricEnabled()
+	if metricEnabled {
+		metricTicker := time.NewTicker(metricTrigger.PollingInterval())
+		defer metricTicker.Stop()
+		metricCh = metricTicker.C
+	}
+
+	// scale operation checks idle time and event rate to scale down, unless scaled by metric
+	var checkCh <-chan time.Time
 	var scaleTime time.Duration
-	if idleEnable, ok := r.Sensor.Labels[consts.ScaleToZeroEnable]; ok || idleEnable == "true" {
-		idleTimeStr, _ := r.Sensor.Labels[consts.ScaleToZeroIdleTime]
-		duration, _ := strconv.Atoi(idleTimeStr)
-		if duration == 0 {
-			duration = 60
-		}
+	if k := r.Sensor.Spec.Actor.Template.K8s; k != nil && k.Operation == v1.Scale && !metricEnabled {
+		scaleTime = time.Duration(k.ScaleToZeroTime) * time.Second
+		zap.L().Info(fmt.Sprintf("runner with ticker check %s, scale down after idle %s", scaleCheckInterval, scaleTime))
+		checkTicker := time.NewTicker(scaleCheckInterval)
+		defer checkTicker.Stop()
+		checkCh = checkTicker.C
 
-		zap.L().Info(fmt.Sprintf("runner with ticker check %d second", duration))
-		scaleTime = time.Duration(duration) * time.Second
-	} else {
-		scaleTime = time.Hour * 24 * 365 * 10
+		// reconcile idle workloads immediately from state persisted before restart
+		r.restoreState()
+		r.check(scaleTime, time.Now())
+	}
+
+	metricsTicker := time.NewTicker(externalMetricsInterval)
+	defer metricsTicker.Stop()
+
+	// events allowed by flow control and batches fired by time window
+	var readyCh, batchCh <-chan event.Event
+	if r.Flow != nil {
+		readyCh = r.Flow.Ready()
+	}
+	if r.Batch != nil {
+		batchCh = r.Batch.Ready()
 	}
-	ticker := time.NewTicker(scaleTime)
 
 	for {
 		select {
 		case event := <-r.eventCh:
-			zap.L().Info(fmt.Sprintf("receive event %s-%s, exec actor", event.Type, event.Source))
-			r.EventMutex.Lock()
-			r.EventCount += 1
-			r.EventLast = time.Now()
-			r.EventMutex.Unlock()
-			err := r.Actor.Exec(r.CTX, event)
-			if err != nil {
-				err = errors.Wrapf(err, "actor exec with event %s-%s", event.Type, event.Source)
-				zap.L().Error("", zap.Error(err))
-			} else {
-				zap.L().Info(fmt.Sprintf("successfully exec event %s-%s with actor", event.Type, event.Source))
+			r.countEvent(eventReceived)
+			if r.isDuplicate(event) {
+				r.countEvent(eventDuplicate)
+				continue
 			}
-			if r.Target != nil {
-				err = r.Target.Exec(r.CTX)
-				if err != nil {
-					err = errors.Wrapf(err, "target exec")
-					zap.L().Error("", zap.Error(err))
-				}
-			}
-		case t := <-ticker.C:
-			r.EventMutex.Lock()
-			err := r.Actor.Check(r.CTX, scaleTime, r.EventLast)
-			r.EventMutex.Unlock()
-			if err != nil {
-				zap.L().Error(fmt.Sprintf("exec Check failed err %s at %d", err.Error(), t.UnixNano()))
+			if r.Flow != nil {
+				r.Flow.Offer(event)
+				continue
 			}
+			r.dispatch(event)
+		case event := <-readyCh:
+			r.dispatch(event)
+		case batch := <-batchCh:
+			r.exec(batch)
+		case <-metricCh:
+			r.scaleByMetric(metricTrigger)
+		case <-metricsTicker.C:
+			r.publishMetrics(externalMetricsInterval)
+		case t := <-checkCh:
+			r.check(scaleTime, t)
+			r.saveState()
 		case <-r.stopCh:
 			zap.L().Warn("receive stop channel, stop!!!")
+			if checkCh != nil {
+				r.saveState()
+			}
 			return nil
 		}
 	}
 }
 
+func (r *runner) check(scaleTime time.Duration, t time.Time) {
+	if r.deferScaleDown(t) {
+		return
+	}
+	r.EventMutex.Lock()
+	lastEvent := r.EventLast
+	r.EventMutex.Unlock()
+	err := r.Actor.Check(r.CTX, scaleTime, lastEvent)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("exec Check failed err %s at %d", err.Error(), t.UnixNano()))
+	}
+}
+
+// deferScaleDown reports whether requests proxied by trigger are in flight, scale down is deferred
+// until they drain or grace period passes, so that long running requests and websockets are not cut off
+func (r *runner) deferScaleDown(now time.Time) bool {
+	t, ok := r.Trigger.(trigger.InFlightInterface)
+	if !ok {
+		return false
+	}
+	inFlight := t.InFlight()
+	if inFlight <= 0 {
+		r.busySince = time.Time{}
+		return false
+	}
+	if r.busySince.IsZero() {
+		r.busySince = now
+	}
+	grace := defaultScaleDownGracePeriod
+	if k := r.Sensor.Spec.Actor.Template.K8s; k != nil && k.ScaleDownGracePeriod > 0 {
+		grace = time.Duration(k.ScaleDownGracePeriod) * time.Second
+	}
+	if now.Sub(r.busySince) >= grace {
+		zap.L().Warn(fmt.Sprintf("sensor %s/%s has %d requests in flight over grace period %s, check scale down",
+			r.Sensor.Namespace, r.Sensor.Name, inFlight, grace))
+		return false
+	}
+	zap.L().Info(fmt.Sprintf("sensor %s/%s defers scale down with %d requests in flight", r.Sensor.Namespace, r.Sensor.Name, inFlight))
+	// requests in flight are activity of sensor
+	r.EventMutex.Lock()
+	r.EventLast = now
+	r.EventMutex.Unlock()
+	return true
+}
+
+// restoreState loads activity state persisted by actor
+func (r *runner) restoreState() {
+	s, ok := r.Actor.(actor.StateInterface)
+	if !ok {
+		return
+	}
+	state, err := s.LoadState(r.CTX)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("load state of sensor %s/%s", r.Sensor.Namespace, r.Sensor.Name), zap.Error(err))
+		return
+	}
+	if state == nil {
+		return
+	}
+	zap.L().Info(fmt.Sprintf("restore sensor %s/%s last event %s, event count %d",
+		r.Sensor.Namespace, r.Sensor.Name, state.LastEvent, state.EventCount))
+	r.EventMutex.Lock()
+	defer r.EventMutex.Unlock()
+	r.EventLast = state.LastEvent
+	r.EventCount = state.EventCount
+	r.savedLast = state.LastEvent
+}
+
+// saveState persists activity state by actor if last event changed since last save
+func (r *runner) saveState() {
+	s, ok := r.Actor.(actor.StateInterface)
+	if !ok {
+		return
+	}
+	r.EventMutex.Lock()
+	state := actor.State{LastEvent: r.EventLast, EventCount: r.EventCount}
+	changed := !r.EventLast.Equal(r.savedLast)
+	r.EventMutex.Unlock()
+	if !changed {
+		return
+	}
+	err := s.SaveState(r.CTX, state)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("save state of sensor %s/%s", r.Sensor.Namespace, r.Sensor.Name), zap.Error(err))
+		return
+	}
+	r.EventMutex.Lock()
+	r.savedLast = state.LastEvent
+	r.EventMutex.Unlock()
+}
+
+// dispatch execs event or collects it into batch
+func (r *runner) dispatch(e event.Event) {
+	if r.Batch == nil {
+		r.exec(e)
+		return
+	}
+	for _, batch := range r.Batch.Add(e) {
+		r.exec(batch)
+	}
+}
+
+// exec submits event to workers, or execs actor inline without workers
+func (r *runner) exec(e event.Event) {
+	if r.Workers != nil {
+		if !r.Workers.Submit(e) {
+			r.countEvent(eventDropped)
+			zap.L().Warn(fmt.Sprintf("drop event %s-%s, queue of its worker is full", e.Type, e.Source))
+		}
+		return
+	}
+	r.execActor(e)
+}
+
+// execActor execs actor within global pool and waits for it
+func (r *runner) execActor(e event.Event) {
+	if r.Pool == nil {
+		r.doExec(e)
+		return
+	}
+	done := make(chan struct{})
+	err := r.Pool.Submit(func() {
+		defer close(done)
+		r.doExec(e)
+	})
+	if err != nil {
+		r.countEvent(eventFailed)
+		zap.L().Error(fmt.Sprintf("submit event %s-%s to actor pool", e.Type, e.Source), zap.Error(err))
+		return
+	}
+	<-done
+}
+
+func (r *runner) doExec(event event.Event) {
+	zap.L().Info(fmt.Sprintf("receive event %s-%s, exec actor", event.Type, event.Source))
+	r.EventMutex.Lock()
+	r.EventCount += 1
+	r.EventLast = time.Now()
+	r.EventMutex.Unlock()
+	err := r.Actor.Exec(r.CTX, event)
+	if err != nil {
+		r.countEvent(eventFailed)
+		err = errors.Wrapf(err, "actor exec with event %s-%s", event.Type, event.Source)
+		zap.L().Error("", zap.Error(err))
+	} else {
+		r.countEvent(eventExecuted)
+		zap.L().Info(fmt.Sprintf("successfully exec event %s-%s with actor", event.Type, event.Source))
+	}
+	if r.Target != nil {
+		err = r.Target.Exec(r.CTX)
+		if err != nil {
+			err = errors.Wrapf(err, "target exec")
+			zap.L().Error("", zap.Error(err))
+		}
+	}
+}
+
+// scaleByMetric scale actor proportionally to metric of trigger
+func (r *runner) scaleByMetric(m trigger.MetricInterface) {
+	scaler, ok := r.Actor.(actor.ScaleInterface)
+	if !ok {
+		return
+	}
+	metric, err := m.GetMetric(r.CTX)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("get metric of sensor %s/%s", r.Sensor.Namespace, r.Sensor.Name), zap.Error(err))
+		return
+	}
+	min, max := scaler.ReplicaRange()
+	replicas := desiredReplicas(metric, min, max)
+	if _, ok := m.(*trigger.KafkaMonitor); ok {
+		server.GlobalExternalMetricsServer.SetMetric(r.Sensor.Namespace, r.Sensor.Name, server.MetricKafkaLag, float64(metric.Value))
+	}
+	if metric.Value > 0 {
+		r.EventMutex.Lock()
+		r.EventLast = time.Now()
+		r.EventMutex.Unlock()
+	}
+	// hpa scales by external metrics instead
+	if scaleByHPA(r.Sensor) {
+		if !server.GlobalExternalMetricsServer.Serving() {
+			zap.L().Warn(fmt.Sprintf("sensor %s/%s is scaled by hpa but external metrics api is not served", r.Sensor.Namespace, r.Sensor.Name))
+		}
+		return
+	}
+	zap.L().Info(fmt.Sprintf("sensor %s/%s metric %d target %d, scale to %d",
+		r.Sensor.Namespace, r.Sensor.Name, metric.Value, metric.Target, replicas))
+	err = scaler.ScaleTo(r.CTX, replicas)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("scale sensor %s/%s by metric", r.Sensor.Namespace, r.Sensor.Name), zap.Error(err))
+	}
+}
+
+// scaleByHPA reports whether scaled object of sensor is scaled by hpa by annotation
+func scaleByHPA(sensor *v1.Sensor) bool {
+	enabled, _ := strconv.ParseBool(sensor.Annotations[consts.ScaleByHPAAnnotation])
+	return enabled
+}
+
+// desiredReplicas is ceil(value / target) within [min, max], it is min while value is 0 to scale to zero
+func desiredReplicas(metric *trigger.ScaleMetric, min, max int32) int32 {
+	if metric.Value <= 0 {
+		return min
+	}
+	target := metric.Target
+	if target <= 0 {
+		target = 1
+	}
+	replicas := int32((metric.Value + target - 1) / target)
+	if metric.MaxReplicas > 0 && replicas > metric.MaxReplicas {
+		replicas = metric.MaxReplicas
+	}
+	if max > 0 && replicas > max {
+		replicas = max
+	}
+	if replicas < min {
+		replicas = min
+	}
+	if replicas < 1 {
+		replicas = 1
+	}
+	return replicas
+}
+
+// isDuplicate report whether event has been seen within dedup window, events are passed if dedup failed
+func (r *runner) isDuplicate(e event.Event) bool {
+	if r.Dedup == nil {
+		return false
+	}
+	key, err := dedup.EventKey(r.Sensor.Spec.Dedup, e)
+	if err != nil {
+		zap.L().Warn(fmt.Sprintf("get dedup key of event %s-%s", e.Type, e.Source), zap.Error(err))
+		return false
+	}
+	if key == "" {
+		return false
+	}
+	seen, err := r.Dedup.Seen(r.CTX, key)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("dedup event %s-%s with key %s", e.Type, e.Source, key), zap.Error(err))
+		return false
+	}
+	if seen {
+		zap.L().Info(fmt.Sprintf("drop duplicate event %s-%s with key %s", e.Type, e.Source, key))
+	}
+	return seen
+}
+
 func (r *runner) Stop() {
 	r.stopCh <- struct{}{}
+	server.GlobalExternalMetricsServer.DeleteSensor(r.Sensor.Namespace, r.Sensor.Name)
+	if r.Flow != nil {
+		r.Flow.Stop()
+	}
+	if r.Batch != nil {
+		r.Batch.Stop()
+	}
+	if r.Workers != nil {
+		r.Workers.Stop()
+	}
 	if r.Trigger == nil {
 		zap.L().Warn("runner monitor is nil")
 		return
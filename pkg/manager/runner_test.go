@@ -1,9 +1,95 @@
 package manager
 
 import (
+	"context"
+	"eventrigger.com/operator/common/consts"
+	"eventrigger.com/operator/common/event"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"eventrigger.com/operator/pkg/trigger"
+	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestScaleToZeroTime(t *testing.T) {
 	return
 }
+
+func TestDesiredReplicas(t *testing.T) {
+	// scale to zero without lag
+	assert.Equal(t, int32(0), desiredReplicas(&trigger.ScaleMetric{Value: 0, Target: 10}, 0, 5))
+	assert.Equal(t, int32(1), desiredReplicas(&trigger.ScaleMetric{Value: 0, Target: 10}, 1, 5))
+	// proportional to lag / threshold
+	assert.Equal(t, int32(1), desiredReplicas(&trigger.ScaleMetric{Value: 3, Target: 10}, 0, 5))
+	assert.Equal(t, int32(3), desiredReplicas(&trigger.ScaleMetric{Value: 21, Target: 10}, 0, 5))
+	// capped by max and partitions
+	assert.Equal(t, int32(5), desiredReplicas(&trigger.ScaleMetric{Value: 100, Target: 10}, 0, 5))
+	assert.Equal(t, int32(2), desiredReplicas(&trigger.ScaleMetric{Value: 100, Target: 10, MaxReplicas: 2}, 0, 0))
+	assert.Equal(t, int32(10), desiredReplicas(&trigger.ScaleMetric{Value: 100, Target: 10}, 0, 0))
+}
+
+type inFlightTrigger struct {
+	inFlight int64
+}
+
+func (t *inFlightTrigger) Run(ctx context.Context, eventChannel chan event.Event) error { return nil }
+func (t *inFlightTrigger) Stop() error                                                  { return nil }
+func (t *inFlightTrigger) InFlight() int64                                              { return t.inFlight }
+
+func TestDeferScaleDown(t *testing.T) {
+	tri := &inFlightTrigger{inFlight: 1}
+	r := &runner{
+		Trigger: tri,
+		Sensor: &v1.Sensor{Spec: v1.SensorSpec{Actor: v1.Actor{Template: &v1.ActorTemplate{
+			K8s: &v1.StandardK8SActor{ScaleDownGracePeriod: 60},
+		}}}},
+	}
+	now := time.Now()
+	assert.True(t, r.deferScaleDown(now))
+	assert.Equal(t, now, r.EventLast)
+	assert.True(t, r.deferScaleDown(now.Add(30*time.Second)))
+	// grace period passed
+	assert.False(t, r.deferScaleDown(now.Add(61*time.Second)))
+	// drained
+	tri.inFlight = 0
+	assert.False(t, r.deferScaleDown(now.Add(62*time.Second)))
+	assert.True(t, r.busySince.IsZero())
+}
+
+type metricTrigger struct {
+	inFlightTrigger
+	value int64
+}
+
+func (t *metricTrigger) MetricEnabled() bool            { return true }
+func (t *metricTrigger) PollingInterval() time.Duration { return time.Second }
+func (t *metricTrigger) GetMetric(ctx context.Context) (*trigger.ScaleMetric, error) {
+	return &trigger.ScaleMetric{Value: t.value, Target: 10}, nil
+}
+
+type scaleActor struct {
+	replicas []int32
+}
+
+func (a *scaleActor) Exec(ctx context.Context, event event.Event) error { return nil }
+func (a *scaleActor) Check(ctx context.Context, scaleTime time.Duration, lastEvent time.Time) error {
+	return nil
+}
+func (a *scaleActor) ReplicaRange() (min, max int32) { return 0, 5 }
+func (a *scaleActor) ScaleTo(ctx context.Context, replicas int32) error {
+	a.replicas = append(a.replicas, replicas)
+	return nil
+}
+
+func TestScaleByMetric(t *testing.T) {
+	act := &scaleActor{}
+	r := &runner{CTX: context.Background(), Actor: act, Sensor: &v1.Sensor{}}
+	r.Sensor.Namespace, r.Sensor.Name = "app", "kafka"
+	r.scaleByMetric(&metricTrigger{value: 21})
+	assert.Equal(t, []int32{3}, act.replicas)
+
+	// hpa of the sensor scales by external metrics, other sensors are still scaled by runners
+	r.Sensor.Annotations = map[string]string{consts.ScaleByHPAAnnotation: "true"}
+	r.scaleByMetric(&metricTrigger{value: 40})
+	assert.Equal(t, []int32{3}, act.replicas)
+}
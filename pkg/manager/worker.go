@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"eventrigger.com/operator/common/event"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"github.com/pkg/errors"
+	"hash/fnv"
+)
+
+const defaultWorkerQueueSize = 64
+
+// workerPool executes events concurrently, events with the same partition key go to the same worker in order
+type workerPool struct {
+	Spec   *v1.Workers
+	queues []chan event.Event
+	exec   func(e event.Event)
+
+	stopCh chan struct{}
+}
+
+func newWorkerPool(spec *v1.Workers, exec func(e event.Event)) (*workerPool, error) {
+	if spec == nil {
+		return nil, errors.New("workers spec is nil")
+	}
+	switch spec.PartitionKey {
+	case "", v1.PartitionBySource, v1.PartitionByKey, v1.PartitionByType:
+	default:
+		return nil, errors.Errorf("not support partition key %s", spec.PartitionKey)
+	}
+	count := int(spec.Count)
+	if count <= 0 {
+		count = 1
+	}
+	size := int(spec.QueueSize)
+	if size <= 0 {
+		size = defaultWorkerQueueSize
+	}
+	p := &workerPool{
+		Spec:   spec,
+		queues: make([]chan event.Event, count),
+		exec:   exec,
+		stopCh: make(chan struct{}),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan event.Event, size)
+	}
+	return p, nil
+}
+
+func (p *workerPool) Start() {
+	for _, queue := range p.queues {
+		go func(queue chan event.Event) {
+			for {
+				select {
+				case e := <-queue:
+					p.exec(e)
+				case <-p.stopCh:
+					return
+				}
+			}
+		}(queue)
+	}
+}
+
+// Submit queues event to the worker of its partition key, it returns false without waiting if the queue is full,
+// so that a hot partition does not block the runner
+func (p *workerPool) Submit(e event.Event) bool {
+	queue := p.queues[p.partition(e)]
+	select {
+	case queue <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *workerPool) partition(e event.Event) int {
+	if len(p.queues) == 1 {
+		return 0
+	}
+	var key string
+	switch p.Spec.PartitionKey {
+	case v1.PartitionByKey:
+		key = e.Key
+		if key == "" {
+			key = e.Source
+		}
+	case v1.PartitionByType:
+		key = e.Type
+	default:
+		key = e.Source
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// Len is the number of queued events
+func (p *workerPool) Len() (n int) {
+	for _, queue := range p.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+// Stop drops queued events, executing ones are not interrupted
+func (p *workerPool) Stop() {
+	close(p.stopCh)
+}
@@ -0,0 +1,66 @@
+package manager
+
+import (
+	"eventrigger.com/operator/common/event"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolKeyOrder(t *testing.T) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	received := map[string][]string{}
+	p, err := newWorkerPool(&v1.Workers{Count: 4, PartitionKey: v1.PartitionByKey, QueueSize: 128}, func(e event.Event) {
+		mutex.Lock()
+		received[e.Key] = append(received[e.Key], e.Data)
+		mutex.Unlock()
+		wg.Done()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start()
+	defer p.Stop()
+
+	keys := []string{"a", "b", "c", "d", "e"}
+	for i := 0; i < 20; i++ {
+		for _, key := range keys {
+			e := event.NewSimpleEvent("kafka", "topic", strconv.Itoa(i))
+			e.Key = key
+			wg.Add(1)
+			assert.True(t, p.Submit(e))
+		}
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if assert.Len(t, received[key], 20) {
+			for i, data := range received[key] {
+				assert.Equal(t, strconv.Itoa(i), data)
+			}
+		}
+	}
+}
+
+func TestWorkerPoolDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	p, err := newWorkerPool(&v1.Workers{Count: 1, QueueSize: 1}, func(e event.Event) {
+		<-release
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start()
+	defer p.Stop()
+	defer close(release)
+
+	// first event is taken by worker, second fills the queue
+	assert.True(t, p.Submit(event.NewSimpleEvent("kafka", "topic", "1")))
+	assert.Eventually(t, func() bool { return p.Len() == 0 }, time.Second, time.Millisecond)
+	assert.True(t, p.Submit(event.NewSimpleEvent("kafka", "topic", "2")))
+	assert.False(t, p.Submit(event.NewSimpleEvent("kafka", "topic", "3")))
+}
@@ -0,0 +1,78 @@
+package trigger
+
+import (
+	"context"
+	"eventrigger.com/operator/common/server"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"sync"
+	"time"
+)
+
+const (
+	defaultActivatorQueueSize = 100
+	// activatorRetryAfter is second clients are told to retry after while cold start is not done
+	activatorRetryAfter = 5
+)
+
+var errActivatorQueueFull = errors.New("too many requests waiting for cold start")
+
+// endpointResolver is implemented by server.GlobalEndpointCache
+type endpointResolver interface {
+	ReadyEndpoints(namespace string, selector labels.Selector) ([]server.Endpoint, error)
+	WaitEndpoints(ctx context.Context, namespace string, selector labels.Selector, timeout time.Duration) ([]server.Endpoint, error)
+}
+
+// activator holds requests while backend of trigger has no ready endpoint, hosts of trigger share the backend.
+// Only the first request of a cold start activates backend, the others are queued until it is ready.
+type activator struct {
+	QueueSize int
+	Timeout   time.Duration
+	resolver  endpointResolver
+
+	mutex      sync.Mutex
+	queued     int
+	activating bool
+}
+
+func newActivator(queueSize int, timeout time.Duration) *activator {
+	if queueSize <= 0 {
+		queueSize = defaultActivatorQueueSize
+	}
+	return &activator{QueueSize: queueSize, Timeout: timeout, resolver: server.GlobalEndpointCache}
+}
+
+// Endpoints returns ready endpoints selected by selector, requests are queued while there is none.
+// activated reports whether activate is called by this request.
+func (a *activator) Endpoints(ctx context.Context, namespace string, selector labels.Selector, activate func()) (endpoints []server.Endpoint, activated bool, err error) {
+	endpoints, err = a.resolver.ReadyEndpoints(namespace, selector)
+	if err != nil || len(endpoints) > 0 {
+		return endpoints, false, err
+	}
+
+	a.mutex.Lock()
+	if a.queued >= a.QueueSize {
+		a.mutex.Unlock()
+		return nil, false, errActivatorQueueFull
+	}
+	a.queued++
+	if !a.activating {
+		a.activating = true
+		activated = true
+	}
+	a.mutex.Unlock()
+	defer func() {
+		a.mutex.Lock()
+		a.queued--
+		if a.queued == 0 {
+			a.activating = false
+		}
+		a.mutex.Unlock()
+	}()
+
+	if activated {
+		activate()
+	}
+	endpoints, err = a.resolver.WaitEndpoints(ctx, namespace, selector, a.Timeout)
+	return endpoints, activated, err
+}
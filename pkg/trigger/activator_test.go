@@ -0,0 +1,81 @@
+package trigger
+
+import (
+	"context"
+	"errors"
+	"eventrigger.com/operator/common/server"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/labels"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeResolver becomes ready once readyCh is closed
+type fakeResolver struct {
+	readyCh chan struct{}
+}
+
+func (f *fakeResolver) ReadyEndpoints(namespace string, selector labels.Selector) ([]server.Endpoint, error) {
+	select {
+	case <-f.readyCh:
+		return testEndpoints, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (f *fakeResolver) WaitEndpoints(ctx context.Context, namespace string, selector labels.Selector, timeout time.Duration) ([]server.Endpoint, error) {
+	select {
+	case <-f.readyCh:
+		return testEndpoints, nil
+	case <-time.After(timeout):
+		return nil, errors.New("timeout")
+	}
+}
+
+func TestActivatorColdStart(t *testing.T) {
+	resolver := &fakeResolver{readyCh: make(chan struct{})}
+	a := newActivator(10, time.Second)
+	a.resolver = resolver
+
+	var activations int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			endpoints, _, err := a.Endpoints(context.Background(), "default", labels.Everything(), func() {
+				atomic.AddInt32(&activations, 1)
+			})
+			assert.NoError(t, err)
+			assert.Len(t, endpoints, len(testEndpoints))
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(resolver.readyCh)
+	wg.Wait()
+	assert.Equal(t, int32(1), activations)
+
+	// warm requests are not queued
+	_, activated, err := a.Endpoints(context.Background(), "default", labels.Everything(), func() {})
+	assert.NoError(t, err)
+	assert.False(t, activated)
+}
+
+func TestActivatorQueueFull(t *testing.T) {
+	a := newActivator(1, 200*time.Millisecond)
+	a.resolver = &fakeResolver{readyCh: make(chan struct{})}
+
+	done := make(chan error)
+	go func() {
+		_, _, err := a.Endpoints(context.Background(), "default", labels.Everything(), func() {})
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	_, _, err := a.Endpoints(context.Background(), "default", labels.Everything(), func() {})
+	assert.Equal(t, errActivatorQueueFull, err)
+	// cold start timeout
+	assert.Error(t, <-done)
+}
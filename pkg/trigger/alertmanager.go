@@ -0,0 +1,238 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"eventrigger.com/operator/common/event"
+	"eventrigger.com/operator/common/server"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert is one alert of alertmanager webhook, it is data of event and its fingerprint, start and status are key of event
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+	// fields of group the alert is in
+	Receiver    string `json:"receiver"`
+	GroupKey    string `json:"groupKey"`
+	ExternalURL string `json:"externalURL"`
+}
+
+type alertmanagerPayload struct {
+	Version     string  `json:"version"`
+	Receiver    string  `json:"receiver"`
+	GroupKey    string  `json:"groupKey"`
+	ExternalURL string  `json:"externalURL"`
+	Alerts      []Alert `json:"alerts"`
+}
+
+// labelMatcher is matcher of alertmanager like severity=critical, severity!=info, alertname=~"Kube.*"
+type labelMatcher struct {
+	Name     string
+	Operator string
+	Value    string
+	re       *regexp.Regexp
+}
+
+func parseLabelMatchers(s string) ([]labelMatcher, error) {
+	var matchers []labelMatcher
+	for _, m := range strings.Split(s, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		var matcher labelMatcher
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if i := strings.Index(m, op); i > 0 {
+				matcher = labelMatcher{Name: m[:i], Operator: op, Value: strings.Trim(m[i+len(op):], `"`)}
+				break
+			}
+		}
+		if matcher.Name == "" {
+			return nil, errors.New(fmt.Sprintf("not valid label matcher %s", m))
+		}
+		if matcher.Operator == "=~" || matcher.Operator == "!~" {
+			re, err := regexp.Compile("^(?:" + matcher.Value + ")$")
+			if err != nil {
+				return nil, errors.Wrapf(err, "not valid label matcher %s", m)
+			}
+			matcher.re = re
+		}
+		matchers = append(matchers, matcher)
+	}
+	return matchers, nil
+}
+
+func (m labelMatcher) match(labels map[string]string) bool {
+	v := labels[m.Name]
+	switch m.Operator {
+	case "=":
+		return v == m.Value
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+type AlertmanagerOptions struct {
+	Hosts []string
+	Paths []string
+	// Status is firing or resolved, empty means both
+	Status string
+	// Labels are matchers alerts must match all of
+	Labels []labelMatcher
+	Auth   AuthOptions
+}
+
+// AlertmanagerTrigger receives webhook of alertmanager, grouped alerts are split into events
+type AlertmanagerTrigger struct {
+	Opts *AlertmanagerOptions
+	Auth *authenticator
+
+	EventChannel chan event.Event
+}
+
+func parseAlertmanagerMeta(meta map[string]string) (opts *AlertmanagerOptions, err error) {
+	opts = &AlertmanagerOptions{
+		Status: meta["status"],
+	}
+	switch opts.Status {
+	case "", AlertFiring, AlertResolved:
+	default:
+		return nil, errors.New(fmt.Sprintf("not valid alert status %s", opts.Status))
+	}
+	if hosts, ok := meta["hosts"]; ok {
+		opts.Hosts = strings.Split(hosts, ",")
+	}
+	if paths, ok := meta["paths"]; ok {
+		opts.Paths = strings.Split(paths, ",")
+	}
+	if len(opts.Hosts) == 0 && len(opts.Paths) == 0 {
+		return nil, errors.New("alertmanager trigger requires hosts or paths")
+	}
+	if labels, ok := meta["labels"]; ok {
+		opts.Labels, err = parseLabelMatchers(labels)
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts.Auth, err = parseAuthMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func NewAlertmanagerTrigger(meta map[string]string, namespace string) (*AlertmanagerTrigger, error) {
+	opts, err := parseAlertmanagerMeta(meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse alertmanager meta")
+	}
+	return &AlertmanagerTrigger{
+		Opts: opts,
+		Auth: newAuthenticator(opts.Auth, namespace),
+	}, nil
+}
+
+func (m *AlertmanagerTrigger) Handler(c *gin.Context) (int, interface{}, error) {
+	if err := m.Auth.Authenticate(c.Request); err != nil {
+		c.Header("WWW-Authenticate", m.Auth.Challenge())
+		return http.StatusUnauthorized, nil, err
+	}
+	var payload alertmanagerPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return http.StatusBadRequest, nil, errors.Wrap(err, "decode alertmanager webhook")
+	}
+
+	events, err := m.split(payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, e := range events {
+		m.EventChannel <- e
+	}
+	zap.L().Debug(fmt.Sprintf("alertmanager group %s sends %d of %d alerts", payload.GroupKey, len(events), len(payload.Alerts)))
+	return 0, server.HttpResponse{Msg: fmt.Sprintf("%d of %d alerts accepted", len(events), len(payload.Alerts))}, nil
+}
+
+// split turns alerts matching filters into events, keyed by fingerprint, start and status so that dedup by
+// message key drops repeated notifications but not resolution of a firing alert or the next firing of it
+func (m *AlertmanagerTrigger) split(payload alertmanagerPayload) ([]event.Event, error) {
+	var events []event.Event
+	for _, alert := range payload.Alerts {
+		if !m.match(alert) {
+			continue
+		}
+		alert.Receiver = payload.Receiver
+		alert.GroupKey = payload.GroupKey
+		alert.ExternalURL = payload.ExternalURL
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal alert")
+		}
+		e := event.NewEvent("", string(v1.AlertmanagerTriggerType), alert.Labels["alertname"], "", string(data), "")
+		e.Key = alert.Fingerprint + "/" + alert.StartsAt.UTC().Format(time.RFC3339Nano) + "/" + alert.Status
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (m *AlertmanagerTrigger) match(alert Alert) bool {
+	if m.Opts.Status != "" && alert.Status != m.Opts.Status {
+		return false
+	}
+	for _, matcher := range m.Opts.Labels {
+		if !matcher.match(alert.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *AlertmanagerTrigger) Run(ctx context.Context, eventChannel chan event.Event) error {
+	m.EventChannel = eventChannel
+	for _, host := range m.Opts.Hosts {
+		zap.L().Info(fmt.Sprintf("alertmanager trigger add host: %s", host))
+		if err := server.GlobalHttpServer.AddOrReplaceHostMap(host, m.Handler); err != nil {
+			return errors.Wrapf(err, "add host %s", host)
+		}
+	}
+	for _, prefix := range m.Opts.Paths {
+		zap.L().Info(fmt.Sprintf("alertmanager trigger add path prefix: %s", prefix))
+		if err := server.GlobalHttpServer.AddOrReplacePathPrefixMap(prefix, m.Handler); err != nil {
+			return errors.Wrapf(err, "add path prefix %s", prefix)
+		}
+	}
+	return nil
+}
+
+func (m *AlertmanagerTrigger) Stop() error {
+	for _, host := range m.Opts.Hosts {
+		server.GlobalHttpServer.DeleteHostMap(host)
+	}
+	for _, prefix := range m.Opts.Paths {
+		server.GlobalHttpServer.DeletePathPrefixMap(prefix)
+	}
+	return nil
+}
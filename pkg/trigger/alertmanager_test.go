@@ -0,0 +1,95 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"eventrigger.com/operator/pkg/dedup"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseLabelMatchers(t *testing.T) {
+	matchers, err := parseLabelMatchers(`alertname=~"Kube.*",severity!=info, team=a`)
+	assert.Nil(t, err)
+	assert.Len(t, matchers, 3)
+	labels := map[string]string{"alertname": "KubePodCrashLooping", "severity": "critical", "team": "a"}
+	for _, m := range matchers {
+		assert.True(t, m.match(labels))
+	}
+	assert.False(t, matchers[0].match(map[string]string{"alertname": "NodeDown"}))
+	assert.False(t, matchers[1].match(map[string]string{"severity": "info"}))
+
+	_, err = parseLabelMatchers("severity")
+	assert.NotNil(t, err)
+	_, err = parseLabelMatchers("alertname=~(")
+	assert.NotNil(t, err)
+}
+
+func TestAlertmanagerSplit(t *testing.T) {
+	_, err := NewAlertmanagerTrigger(map[string]string{"paths": "/alerts", "status": "pending"}, "app")
+	assert.NotNil(t, err)
+
+	m, err := NewAlertmanagerTrigger(map[string]string{
+		"paths":  "/alerts",
+		"status": "firing",
+		"labels": "severity=~critical|warning",
+	}, "app")
+	assert.Nil(t, err)
+
+	payload := alertmanagerPayload{
+		Receiver: "eventrigger",
+		GroupKey: "{}:{alertname=\"HighCPU\"}",
+		Alerts: []Alert{
+			{Status: "firing", Fingerprint: "f1", StartsAt: time.Date(2021, 10, 1, 8, 0, 0, 0, time.UTC), Labels: map[string]string{"alertname": "HighCPU", "severity": "critical"},
+				Annotations: map[string]string{"summary": "cpu"}},
+			{Status: "firing", Fingerprint: "f2", Labels: map[string]string{"alertname": "HighCPU", "severity": "info"}},
+			{Status: "resolved", Fingerprint: "f3", Labels: map[string]string{"alertname": "HighCPU", "severity": "critical"}},
+			{Status: "firing", Fingerprint: "f4", Labels: map[string]string{"alertname": "HighCPU", "severity": "warning"}},
+		},
+	}
+	events, err := m.split(payload)
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "f1/2021-10-01T08:00:00Z/firing", events[0].Key)
+	assert.Equal(t, "HighCPU", events[0].Source)
+	assert.Equal(t, "alertmanager", events[0].Type)
+	assert.Equal(t, "f4/0001-01-01T00:00:00Z/firing", events[1].Key)
+
+	var alert Alert
+	assert.Nil(t, json.Unmarshal([]byte(events[0].Data), &alert))
+	assert.Equal(t, "eventrigger", alert.Receiver)
+	assert.Equal(t, "cpu", alert.Annotations["summary"])
+	assert.Equal(t, "firing", alert.Status)
+}
+
+func TestAlertmanagerDedup(t *testing.T) {
+	m, err := NewAlertmanagerTrigger(map[string]string{"paths": "/alerts"}, "app")
+	assert.Nil(t, err)
+	spec := &v1.Deduplication{Key: v1.DedupMessageKey}
+	d := dedup.NewMemoryDeduplicator(time.Minute)
+
+	startsAt := time.Now().Add(-time.Hour)
+	notify := func(status string) bool {
+		events, err := m.split(alertmanagerPayload{Alerts: []Alert{
+			{Status: status, Fingerprint: "f1", StartsAt: startsAt, Labels: map[string]string{"alertname": "HighCPU"}},
+		}})
+		assert.Nil(t, err)
+		key, err := dedup.EventKey(spec, events[0])
+		assert.Nil(t, err)
+		seen, err := d.Seen(context.Background(), key)
+		assert.Nil(t, err)
+		return !seen
+	}
+	// alertmanager repeats firing alerts every repeat_interval, only the first is delivered
+	assert.True(t, notify(AlertFiring))
+	assert.False(t, notify(AlertFiring))
+	// resolution of the alert is delivered
+	assert.True(t, notify(AlertResolved))
+	assert.False(t, notify(AlertResolved))
+	// the alert fires again since a new start
+	startsAt = time.Now()
+	assert.True(t, notify(AlertFiring))
+	assert.False(t, notify(AlertFiring))
+}
@@ -0,0 +1,421 @@
+package trigger
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"eventrigger.com/operator/common/server"
+	"fmt"
+	"github.com/form3tech-oss/jwt-go"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAPIKeyHeader = "X-API-Key"
+	defaultJWTSecretKey = "key"
+
+	// jwksRefresh is how long keys of jwks url are cached, unknown kid refreshes keys at most once per jwksMinRefresh
+	jwksRefresh    = 5 * time.Minute
+	jwksMinRefresh = 10 * time.Second
+)
+
+// AuthOptions authenticates requests of http and k8s_http triggers, a request passes if any configured method passes.
+// Secrets are names of secrets in namespace of sensor.
+type AuthOptions struct {
+	// APIKeySecret holds valid api keys as its values, the key is sent in APIKeyHeader
+	APIKeySecret string
+	APIKeyHeader string
+	// BasicAuthSecret is of type kubernetes.io/basic-auth with username and password
+	BasicAuthSecret string
+	// bearer jwt is verified with keys of JWKSURL, or JWTSecretKey of JWTSecret holding hmac secret or pem public key
+	JWKSURL      string
+	JWTSecret    string
+	JWTSecretKey string
+	JWTAudience  string
+	JWTIssuer    string
+	// JWTClaims are claims jwt must have, values of array claims should contain them
+	JWTClaims map[string]string
+}
+
+func parseAuthMeta(meta map[string]string) (opts AuthOptions, err error) {
+	opts = AuthOptions{
+		APIKeySecret:    meta["apiKeySecret"],
+		APIKeyHeader:    meta["apiKeyHeader"],
+		BasicAuthSecret: meta["basicAuthSecret"],
+		JWKSURL:         meta["jwksUrl"],
+		JWTSecret:       meta["jwtSecret"],
+		JWTSecretKey:    meta["jwtSecretKey"],
+		JWTAudience:     meta["jwtAudience"],
+		JWTIssuer:       meta["jwtIssuer"],
+	}
+	if opts.APIKeyHeader == "" {
+		opts.APIKeyHeader = defaultAPIKeyHeader
+	}
+	if opts.JWTSecretKey == "" {
+		opts.JWTSecretKey = defaultJWTSecretKey
+	}
+	if opts.JWKSURL != "" && opts.JWTSecret != "" {
+		return opts, errors.New("jwksUrl and jwtSecret cannot be both set")
+	}
+	for key, name := range map[string]string{
+		"apiKeySecret":    opts.APIKeySecret,
+		"basicAuthSecret": opts.BasicAuthSecret,
+		"jwtSecret":       opts.JWTSecret,
+	} {
+		if err := validSecretName(key, name); err != nil {
+			return opts, err
+		}
+	}
+	if claims, ok := meta["jwtClaims"]; ok && claims != "" {
+		opts.JWTClaims = make(map[string]string)
+		for _, kv := range strings.Split(claims, ",") {
+			pair := strings.SplitN(kv, "=", 2)
+			if len(pair) != 2 || pair[0] == "" {
+				return opts, errors.New(fmt.Sprintf("not valid jwtClaims %s", claims))
+			}
+			opts.JWTClaims[pair[0]] = pair[1]
+		}
+	}
+	return opts, nil
+}
+
+func (o AuthOptions) jwtEnabled() bool {
+	return o.JWKSURL != "" || o.JWTSecret != ""
+}
+
+type secretGetter func(namespace, name string) (*v1.Secret, error)
+
+// authenticator checks credentials of requests before events are sent, secrets are read on every request
+// from cache, so that rotated credentials take effect at once
+type authenticator struct {
+	Opts      AuthOptions
+	Namespace string
+
+	secrets secretGetter
+	jwks    *jwksCache
+}
+
+// newAuthenticator returns nil if no method is configured, secrets are read from namespace
+func newAuthenticator(opts AuthOptions, namespace string) *authenticator {
+	if opts.APIKeySecret == "" && opts.BasicAuthSecret == "" && !opts.jwtEnabled() {
+		return nil
+	}
+	a := &authenticator{
+		Opts:      opts,
+		Namespace: namespace,
+		secrets:   server.GlobalSecretCache.Get,
+	}
+	if opts.JWKSURL != "" {
+		a.jwks = newJWKSCache(opts.JWKSURL)
+	}
+	return a
+}
+
+// Authenticate returns error if request passes none of configured methods, nil authenticator passes all requests
+func (a *authenticator) Authenticate(req *http.Request) error {
+	if a == nil {
+		return nil
+	}
+	var reasons []string
+	if a.Opts.APIKeySecret != "" {
+		err := a.apiKey(req)
+		if err == nil {
+			return nil
+		}
+		reasons = append(reasons, err.Error())
+	}
+	if a.Opts.BasicAuthSecret != "" {
+		err := a.basicAuth(req)
+		if err == nil {
+			return nil
+		}
+		reasons = append(reasons, err.Error())
+	}
+	if a.Opts.jwtEnabled() {
+		err := a.bearerJWT(req)
+		if err == nil {
+			return nil
+		}
+		reasons = append(reasons, err.Error())
+	}
+	return errors.New(fmt.Sprintf("unauthorized: %s", strings.Join(reasons, "; ")))
+}
+
+// Challenge is WWW-Authenticate header of rejected requests
+func (a *authenticator) Challenge() string {
+	if a.Opts.BasicAuthSecret != "" {
+		return `Basic realm="eventrigger"`
+	}
+	if a.Opts.jwtEnabled() {
+		return `Bearer realm="eventrigger"`
+	}
+	return ""
+}
+
+func (a *authenticator) secret(name string) (*v1.Secret, error) {
+	return a.secrets(a.Namespace, name)
+}
+
+func (a *authenticator) apiKey(req *http.Request) error {
+	key := req.Header.Get(a.Opts.APIKeyHeader)
+	if key == "" {
+		return errors.New(fmt.Sprintf("no api key in header %s", a.Opts.APIKeyHeader))
+	}
+	s, err := a.secret(a.Opts.APIKeySecret)
+	if err != nil {
+		return err
+	}
+	for _, valid := range s.Data {
+		if len(valid) > 0 && subtle.ConstantTimeCompare([]byte(key), valid) == 1 {
+			return nil
+		}
+	}
+	return errors.New("api key is not valid")
+}
+
+func (a *authenticator) basicAuth(req *http.Request) error {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return errors.New("no basic auth")
+	}
+	s, err := a.secret(a.Opts.BasicAuthSecret)
+	if err != nil {
+		return err
+	}
+	validUser := subtle.ConstantTimeCompare([]byte(username), s.Data[v1.BasicAuthUsernameKey]) == 1
+	validPassword := subtle.ConstantTimeCompare([]byte(password), s.Data[v1.BasicAuthPasswordKey]) == 1
+	if !validUser || !validPassword {
+		return errors.New("username or password is not valid")
+	}
+	return nil
+}
+
+func (a *authenticator) bearerJWT(req *http.Request) error {
+	auth := req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return errors.New("no bearer token")
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(strings.TrimSpace(auth[7:]), claims, a.jwtKey); err != nil {
+		return errors.Wrap(err, "jwt is not valid")
+	}
+	if a.Opts.JWTAudience != "" && !claims.VerifyAudience(a.Opts.JWTAudience, true) {
+		return errors.New(fmt.Sprintf("jwt audience is not %s", a.Opts.JWTAudience))
+	}
+	if a.Opts.JWTIssuer != "" && !claims.VerifyIssuer(a.Opts.JWTIssuer, true) {
+		return errors.New(fmt.Sprintf("jwt issuer is not %s", a.Opts.JWTIssuer))
+	}
+	for k, v := range a.Opts.JWTClaims {
+		if !claimContains(claims[k], v) {
+			return errors.New(fmt.Sprintf("jwt claim %s is not %s", k, v))
+		}
+	}
+	return nil
+}
+
+// jwtKey is key to verify token, algorithm of token must match type of key, so that public key is never used as hmac secret
+func (a *authenticator) jwtKey(token *jwt.Token) (interface{}, error) {
+	if a.jwks != nil {
+		kid, _ := token.Header["kid"].(string)
+		key, err := a.jwks.Key(kid)
+		if err != nil {
+			return nil, err
+		}
+		return key, checkKeyMethod(key, token.Method)
+	}
+
+	s, err := a.secret(a.Opts.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := s.Data[a.Opts.JWTSecretKey]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("no %s in jwt secret %s", a.Opts.JWTSecretKey, a.Opts.JWTSecret))
+	}
+	var key interface{} = raw
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "-----BEGIN") {
+		if key, err = jwt.ParseRSAPublicKeyFromPEM(raw); err != nil {
+			if key, err = jwt.ParseECPublicKeyFromPEM(raw); err != nil {
+				return nil, errors.New("jwt secret is neither rsa nor ecdsa public key")
+			}
+		}
+	}
+	return key, checkKeyMethod(key, token.Method)
+}
+
+func checkKeyMethod(key interface{}, method jwt.SigningMethod) error {
+	var ok bool
+	switch key.(type) {
+	case []byte:
+		_, ok = method.(*jwt.SigningMethodHMAC)
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			ok = true
+		}
+	case *ecdsa.PublicKey:
+		_, ok = method.(*jwt.SigningMethodECDSA)
+	}
+	if !ok {
+		return errors.New(fmt.Sprintf("jwt algorithm %s does not match key", method.Alg()))
+	}
+	return nil
+}
+
+func claimContains(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, item := range c {
+			if fmt.Sprint(item) == value {
+				return true
+			}
+		}
+		return false
+	case string:
+		return c == value
+	default:
+		return fmt.Sprint(c) == value
+	}
+}
+
+// jwksCache caches public keys of jwks url by kid
+type jwksCache struct {
+	URL    string
+	client *http.Client
+
+	mutex   sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{
+		URL:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]interface{}),
+	}
+}
+
+// Key returns key of kid, keys are fetched again once expired or kid is unknown
+func (c *jwksCache) Key(kid string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key, ok := c.keys[kid]
+	age := time.Since(c.fetched)
+	if (ok && age < jwksRefresh) || (!ok && age < jwksMinRefresh) {
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("no key of kid %q in jwks", kid))
+		}
+		return key, nil
+	}
+	if err := c.fetch(); err != nil {
+		if ok {
+			// keep using cached key while jwks url is unavailable
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, ok = c.keys[kid]; !ok {
+		return nil, errors.New(fmt.Sprintf("no key of kid %q in jwks", kid))
+	}
+	return key, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetch replaces keys with those of jwks url, caller should hold the mutex
+func (c *jwksCache) fetch() error {
+	c.fetched = time.Now()
+	resp, err := c.client.Get(c.URL)
+	if err != nil {
+		return errors.Wrapf(err, "get jwks %s", c.URL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("get jwks %s status %d", c.URL, resp.StatusCode))
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return errors.Wrapf(err, "decode jwks %s", c.URL)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	c.keys = keys
+	return nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New(fmt.Sprintf("not support curve %s", k.Crv))
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("not support key type %s", k.Kty))
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
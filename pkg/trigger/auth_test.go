@@ -0,0 +1,147 @@
+package trigger
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/form3tech-oss/jwt-go"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func fakeSecrets(secrets map[string]*v1.Secret) secretGetter {
+	return func(namespace, name string) (*v1.Secret, error) {
+		s, ok := secrets[namespace+"/"+name]
+		if !ok {
+			return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
+		}
+		return s, nil
+	}
+}
+
+func TestParseAuthMeta(t *testing.T) {
+	opts, err := parseAuthMeta(map[string]string{"jwtClaims": "role=admin,team=a"})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultAPIKeyHeader, opts.APIKeyHeader)
+	assert.Equal(t, map[string]string{"role": "admin", "team": "a"}, opts.JWTClaims)
+	assert.Nil(t, newAuthenticator(opts, "app"))
+
+	_, err = parseAuthMeta(map[string]string{"jwtClaims": "role"})
+	assert.NotNil(t, err)
+	_, err = parseAuthMeta(map[string]string{"jwksUrl": "http://a", "jwtSecret": "s"})
+	assert.NotNil(t, err)
+	// secrets of other namespaces cannot be referred
+	_, err = parseAuthMeta(map[string]string{"basicAuthSecret": "other/basic"})
+	assert.NotNil(t, err)
+}
+
+func TestAuthenticateAPIKeyAndBasic(t *testing.T) {
+	opts, _ := parseAuthMeta(map[string]string{"apiKeySecret": "keys", "basicAuthSecret": "basic"})
+	a := newAuthenticator(opts, "app")
+	a.secrets = fakeSecrets(map[string]*v1.Secret{
+		"app/keys": {Data: map[string][]byte{"ci": []byte("k1"), "bot": []byte("k2")}},
+		"app/basic": {Data: map[string][]byte{
+			v1.BasicAuthUsernameKey: []byte("user"),
+			v1.BasicAuthPasswordKey: []byte("pass"),
+		}},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	assert.NotNil(t, a.Authenticate(req))
+	req.Header.Set(defaultAPIKeyHeader, "k2")
+	assert.Nil(t, a.Authenticate(req))
+	req.Header.Set(defaultAPIKeyHeader, "k3")
+	assert.NotNil(t, a.Authenticate(req))
+
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.SetBasicAuth("user", "pass")
+	assert.Nil(t, a.Authenticate(req))
+	req.SetBasicAuth("user", "wrong")
+	assert.NotNil(t, a.Authenticate(req))
+	assert.Equal(t, `Basic realm="eventrigger"`, a.Challenge())
+
+	var nilAuth *authenticator
+	assert.Nil(t, nilAuth.Authenticate(req))
+}
+
+func TestAuthenticateJWTSecret(t *testing.T) {
+	opts, _ := parseAuthMeta(map[string]string{
+		"jwtSecret":   "jwt",
+		"jwtAudience": "eventrigger",
+		"jwtIssuer":   "ci",
+		"jwtClaims":   "role=deployer",
+	})
+	a := newAuthenticator(opts, "app")
+	a.secrets = fakeSecrets(map[string]*v1.Secret{"app/jwt": {Data: map[string][]byte{"key": []byte("hmac")}}})
+
+	sign := func(claims jwt.MapClaims) *http.Request {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("hmac"))
+		assert.Nil(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+	valid := jwt.MapClaims{
+		"aud":  []string{"eventrigger", "other"},
+		"iss":  "ci",
+		"role": []string{"viewer", "deployer"},
+		"exp":  time.Now().Add(time.Minute).Unix(),
+	}
+	assert.Nil(t, a.Authenticate(sign(valid)))
+
+	expired := jwt.MapClaims{"aud": "eventrigger", "iss": "ci", "role": "deployer", "exp": time.Now().Add(-time.Minute).Unix()}
+	assert.NotNil(t, a.Authenticate(sign(expired)))
+	wrongAud := jwt.MapClaims{"aud": "other", "iss": "ci", "role": "deployer"}
+	assert.NotNil(t, a.Authenticate(sign(wrongAud)))
+	wrongClaim := jwt.MapClaims{"aud": "eventrigger", "iss": "ci", "role": "viewer"}
+	assert.NotNil(t, a.Authenticate(sign(wrongClaim)))
+	assert.NotNil(t, a.Authenticate(httptest.NewRequest(http.MethodPost, "/", nil)))
+}
+
+func TestAuthenticateJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	fetches := 0
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer jwks.Close()
+
+	opts, _ := parseAuthMeta(map[string]string{"jwksUrl": jwks.URL})
+	a := newAuthenticator(opts, "app")
+	sign := func(kid string, method jwt.SigningMethod, signKey interface{}) *http.Request {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "a"})
+		token.Header["kid"] = kid
+		s, err := token.SignedString(signKey)
+		assert.Nil(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+s)
+		return req
+	}
+	assert.Nil(t, a.Authenticate(sign("k1", jwt.SigningMethodRS256, key)))
+	assert.Nil(t, a.Authenticate(sign("k1", jwt.SigningMethodRS256, key)))
+	assert.Equal(t, 1, fetches)
+
+	// unknown kid does not refetch within jwksMinRefresh
+	assert.NotNil(t, a.Authenticate(sign("k2", jwt.SigningMethodRS256, key)))
+	assert.Equal(t, 1, fetches)
+	// hmac signed with public key must not pass
+	pub, _ := json.Marshal(key.PublicKey)
+	assert.NotNil(t, a.Authenticate(sign("k1", jwt.SigningMethodHS256, pub)))
+}
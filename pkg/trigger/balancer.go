@@ -0,0 +1,252 @@
+package trigger
+
+import (
+	"bytes"
+	"crypto/tls"
+	"eventrigger.com/operator/common/server"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type lbPolicy string
+
+const (
+	RoundRobinPolicy       lbPolicy = "round-robin"
+	LeastOutstandingPolicy lbPolicy = "least-outstanding"
+	ConsistentHashPolicy   lbPolicy = "consistent-hash"
+
+	defaultEjectSeconds = 30
+	defaultRetries      = 2
+)
+
+// balancer picks endpoint of each request, endpoints failed to connect are ejected for a while
+type balancer struct {
+	Policy     lbPolicy
+	HashHeader string
+	Eject      time.Duration
+
+	mutex       sync.Mutex
+	next        int
+	outstanding map[string]int64
+	ejected     map[string]time.Time
+}
+
+func newBalancer(policy lbPolicy, hashHeader string, eject time.Duration) (*balancer, error) {
+	switch policy {
+	case "":
+		policy = RoundRobinPolicy
+	case RoundRobinPolicy, LeastOutstandingPolicy:
+	case ConsistentHashPolicy:
+		if hashHeader == "" {
+			return nil, errors.New("consistent hash policy requires hash header")
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("not support lb policy %s", policy))
+	}
+	return &balancer{
+		Policy:      policy,
+		HashHeader:  hashHeader,
+		Eject:       eject,
+		outstanding: make(map[string]int64),
+		ejected:     make(map[string]time.Time),
+	}, nil
+}
+
+// Pick picks endpoint not in tried, ejected endpoints are only picked while all the others are ejected
+func (b *balancer) Pick(endpoints []server.Endpoint, req *http.Request, tried map[string]bool) (server.Endpoint, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	var healthy, candidates []server.Endpoint
+	for _, ep := range endpoints {
+		if tried[ep.Address] {
+			continue
+		}
+		candidates = append(candidates, ep)
+		if until, ok := b.ejected[ep.Address]; ok && until.After(now) {
+			continue
+		}
+		healthy = append(healthy, ep)
+	}
+	if len(healthy) > 0 {
+		candidates = healthy
+	}
+	if len(candidates) == 0 {
+		return server.Endpoint{}, false
+	}
+
+	switch b.Policy {
+	case LeastOutstandingPolicy:
+		picked := candidates[0]
+		for _, ep := range candidates[1:] {
+			if b.outstanding[ep.Address] < b.outstanding[picked.Address] {
+				picked = ep
+			}
+		}
+		return picked, true
+	case ConsistentHashPolicy:
+		if key := req.Header.Get(b.HashHeader); key != "" {
+			return rendezvous(candidates, key), true
+		}
+	}
+	b.next = (b.next + 1) % len(candidates)
+	return candidates[b.next], true
+}
+
+// rendezvous picks endpoint with the highest hash of key and address, so that keys move only when their endpoint changes
+func rendezvous(endpoints []server.Endpoint, key string) server.Endpoint {
+	var picked server.Endpoint
+	var max uint64
+	for i, ep := range endpoints {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte(ep.Address))
+		if sum := h.Sum64(); i == 0 || sum > max {
+			picked, max = ep, sum
+		}
+	}
+	return picked
+}
+
+func (b *balancer) acquire(address string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.outstanding[address]++
+}
+
+func (b *balancer) release(address string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.outstanding[address]--
+	if b.outstanding[address] <= 0 {
+		delete(b.outstanding, address)
+	}
+}
+
+func (b *balancer) eject(address string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.ejected[address] = time.Now().Add(b.Eject)
+	for addr, until := range b.ejected {
+		if until.Before(time.Now()) {
+			delete(b.ejected, addr)
+		}
+	}
+}
+
+// h2cTransport proxies http/2 requests like grpc to endpoints without tls
+var h2cTransport = &http2.Transport{
+	AllowHTTP: true,
+	DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+		return net.Dial(network, addr)
+	},
+}
+
+// lbTransport sends request to endpoint picked by balancer, idempotent requests are retried on another endpoint.
+// Body of streaming requests is not buffered, they are never retried.
+type lbTransport struct {
+	balancer  *balancer
+	endpoints []server.Endpoint
+	body      []byte
+	stream    bool
+	retries   int
+	base      http.RoundTripper
+}
+
+func (t *lbTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if isIdempotent(req.Method) && !t.stream {
+		attempts += t.retries
+	}
+	tried := map[string]bool{}
+	lastErr := errors.New("no endpoint available")
+	for i := 0; i < attempts; i++ {
+		ep, ok := t.balancer.Pick(t.endpoints, req, tried)
+		if !ok {
+			break
+		}
+		tried[ep.Address] = true
+		outReq := req.Clone(req.Context())
+		outReq.URL.Host = ep.Address
+		if !t.stream {
+			outReq.Body = http.NoBody
+			if len(t.body) > 0 {
+				outReq.Body = ioutil.NopCloser(bytes.NewReader(t.body))
+			}
+			outReq.ContentLength = int64(len(t.body))
+		}
+		t.balancer.acquire(ep.Address)
+		resp, err := t.base.RoundTrip(outReq)
+		if err != nil {
+			t.balancer.release(ep.Address)
+			t.balancer.eject(ep.Address)
+			zap.L().Info(fmt.Sprintf("eject endpoint %s of pod %s: %v", ep.Address, ep.Pod, err))
+			lastErr = err
+			continue
+		}
+		address := ep.Address
+		release := func() { t.balancer.release(address) }
+		// body of upgraded response like websocket is the connection, it must stay writable for proxy
+		if rwc, ok := resp.Body.(io.ReadWriteCloser); ok && resp.StatusCode == http.StatusSwitchingProtocols {
+			resp.Body = &releaseConn{ReadWriteCloser: rwc, release: release}
+		} else {
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// releaseBody releases outstanding request of endpoint once response body is closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
+
+// releaseConn releases outstanding request of endpoint once upgraded connection is closed
+type releaseConn struct {
+	io.ReadWriteCloser
+	once    sync.Once
+	release func()
+}
+
+func (c *releaseConn) Close() error {
+	c.once.Do(c.release)
+	return c.ReadWriteCloser.Close()
+}
+
+// isStreaming reports whether request is websocket upgrade or grpc, whose body should not be buffered
+func isStreaming(req *http.Request) bool {
+	if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		return true
+	}
+	return isGrpc(req)
+}
+
+func isGrpc(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
@@ -0,0 +1,141 @@
+package trigger
+
+import (
+	"bufio"
+	"eventrigger.com/operator/common/server"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEndpoints = []server.Endpoint{{Pod: "a", Address: "10.0.0.1:80"}, {Pod: "b", Address: "10.0.0.2:80"}, {Pod: "c", Address: "10.0.0.3:80"}}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	b, _ := newBalancer(RoundRobinPolicy, "", time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	picked := map[string]int{}
+	for i := 0; i < 6; i++ {
+		ep, ok := b.Pick(testEndpoints, req, nil)
+		assert.True(t, ok)
+		picked[ep.Pod]++
+	}
+	assert.Equal(t, map[string]int{"a": 2, "b": 2, "c": 2}, picked)
+
+	// ejected endpoint is skipped
+	b.eject("10.0.0.1:80")
+	for i := 0; i < 4; i++ {
+		ep, _ := b.Pick(testEndpoints, req, nil)
+		assert.NotEqual(t, "a", ep.Pod)
+	}
+}
+
+func TestBalancerLeastOutstanding(t *testing.T) {
+	b, _ := newBalancer(LeastOutstandingPolicy, "", time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	b.acquire("10.0.0.1:80")
+	b.acquire("10.0.0.3:80")
+	ep, _ := b.Pick(testEndpoints, req, nil)
+	assert.Equal(t, "b", ep.Pod)
+}
+
+func TestBalancerConsistentHash(t *testing.T) {
+	_, err := newBalancer(ConsistentHashPolicy, "", time.Minute)
+	assert.Error(t, err)
+
+	b, _ := newBalancer(ConsistentHashPolicy, "X-User", time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", "alice")
+	first, _ := b.Pick(testEndpoints, req, nil)
+	for i := 0; i < 5; i++ {
+		ep, _ := b.Pick(testEndpoints, req, nil)
+		assert.Equal(t, first, ep)
+	}
+}
+
+func TestLBTransportRetry(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer backend.Close()
+	// closed listener refuses connections
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	refused := l.Addr().String()
+	l.Close()
+
+	b, _ := newBalancer(LeastOutstandingPolicy, "", time.Minute)
+	transport := &lbTransport{
+		balancer:  b,
+		endpoints: []server.Endpoint{{Pod: "down", Address: refused}, {Pod: "up", Address: strings.TrimPrefix(backend.URL, "http://")}},
+		body:      []byte("hello"),
+		retries:   1,
+		base:      http.DefaultTransport,
+	}
+	req := httptest.NewRequest(http.MethodPut, "http://placeholder/", nil)
+	req.RequestURI = ""
+	resp, err := transport.RoundTrip(req)
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "hello", string(body))
+	}
+	assert.Empty(t, b.outstanding)
+
+	// post is not retried
+	req = httptest.NewRequest(http.MethodPost, "http://placeholder/", nil)
+	req.RequestURI = ""
+	b.ejected = map[string]time.Time{}
+	_, err = transport.RoundTrip(req)
+	assert.Error(t, err)
+}
+
+func TestLBTransportUpgrade(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+		line, _ := buf.ReadString('\n')
+		buf.WriteString(line)
+		buf.Flush()
+	}))
+	defer backend.Close()
+
+	b, _ := newBalancer(RoundRobinPolicy, "", time.Minute)
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) { req.URL.Scheme = "http" },
+		Transport: &lbTransport{
+			balancer:  b,
+			endpoints: []server.Endpoint{{Pod: "ws", Address: strings.TrimPrefix(backend.URL, "http://")}},
+			stream:    true,
+			base:      http.DefaultTransport,
+		},
+	}
+	front := httptest.NewServer(proxy)
+	defer front.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(front.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: ws\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	conn.Write([]byte("ping\n"))
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "ping\n", line)
+}
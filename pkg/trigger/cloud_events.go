@@ -5,16 +5,25 @@ import (
 	"eventrigger.com/operator/common/event"
 	"eventrigger.com/operator/common/server"
 	"fmt"
-	"github.com/mitchellh/mapstructure"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"strings"
 )
 
+// CloudEventsOptions filters cloud events received by cloud events server, empty option passes all
 type CloudEventsOptions struct {
-	Namespace  string
-	APIVersion string
-	Kind       string
-	Type       string
+	Source       string
+	SourcePrefix string
+	SourceSuffix string
+	Type         string
+	TypePrefix   string
+	TypeSuffix   string
+	SpecVersion  string
+	// Extensions are extension attributes events must have, like partitionkey=a,tenant=b
+	Extensions map[string]string
 }
 
 type CloudEventsTrigger struct {
@@ -24,11 +33,25 @@ type CloudEventsTrigger struct {
 }
 
 func parseCloudEventsMeta(meta map[string]string) (opts *CloudEventsOptions, err error) {
-	opts = &CloudEventsOptions{}
-
-	err = mapstructure.Decode(meta, opts)
-	if err != nil {
-		return nil, errors.Wrap(err, "parse k8s events trigger")
+	opts = &CloudEventsOptions{
+		Source:       meta["source"],
+		SourcePrefix: meta["sourcePrefix"],
+		SourceSuffix: meta["sourceSuffix"],
+		Type:         meta["type"],
+		TypePrefix:   meta["typePrefix"],
+		TypeSuffix:   meta["typeSuffix"],
+		SpecVersion:  meta["specVersion"],
+	}
+	if extensions, ok := meta["extensions"]; ok {
+		opts.Extensions = make(map[string]string)
+		for _, ext := range strings.Split(extensions, ",") {
+			kv := strings.SplitN(ext, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, errors.New(fmt.Sprintf("not valid extension %s, it should be like name=value", ext))
+			}
+			// names of extension attributes are lower case
+			opts.Extensions[strings.ToLower(kv[0])] = kv[1]
+		}
 	}
 
 	return opts, nil
@@ -37,25 +60,59 @@ func parseCloudEventsMeta(meta map[string]string) (opts *CloudEventsOptions, err
 func NewCloudEventsTrigger(meta map[string]string) (*CloudEventsTrigger, error) {
 	opts, err := parseCloudEventsMeta(meta)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "parse cloud events meta")
 	}
 	m := &CloudEventsTrigger{
 		Opts: opts,
-		Key:  server.UniqueK8sEventKey(opts.Kind, opts.Type, opts.APIVersion, opts.Namespace),
+		// triggers of same options are different subscribers
+		Key: server.UniqueCloudEventsKey(opts.Source, opts.Type, opts.SpecVersion) + "-" + string(uuid.NewUUID()),
 	}
 
 	return m, nil
 }
 
+// Match reports whether cloud event passes filters
+func (m *CloudEventsTrigger) Match(e cloudevents.Event) bool {
+	if !matchString(e.Source(), m.Opts.Source, m.Opts.SourcePrefix, m.Opts.SourceSuffix) {
+		return false
+	}
+	if !matchString(e.Type(), m.Opts.Type, m.Opts.TypePrefix, m.Opts.TypeSuffix) {
+		return false
+	}
+	if m.Opts.SpecVersion != "" && e.SpecVersion() != m.Opts.SpecVersion {
+		return false
+	}
+	extensions := e.Extensions()
+	for name, value := range m.Opts.Extensions {
+		v, ok := extensions[name]
+		if !ok {
+			return false
+		}
+		s, err := types.Format(v)
+		if err != nil || s != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchString reports whether s equals exact, has prefix and has suffix, empty ones are skipped
+func matchString(s, exact, prefix, suffix string) bool {
+	if exact != "" && s != exact {
+		return false
+	}
+	return strings.HasPrefix(s, prefix) && strings.HasSuffix(s, suffix)
+}
+
 func (m *CloudEventsTrigger) Run(ctx context.Context, eventChannel chan event.Event) error {
 	m.EventChannel = &eventChannel
-	server.GlobalK8sEventsMonitor.UpdateMonitor(m.Key, &eventChannel)
-	zap.L().Debug(fmt.Sprintf("k8s events trigger add monitor with event: %s exist", m.Key))
+	server.GlobalCloudEventsServer.UpdateMonitor(m.Key, server.CloudEventsSubscriber{Channel: &eventChannel, Match: m.Match})
+	zap.L().Debug(fmt.Sprintf("cloud events trigger add monitor with event: %s exist", m.Key))
 	return nil
 }
 
 func (m *CloudEventsTrigger) Stop() error {
-	server.GlobalK8sEventsMonitor.DeleteMonitor(m.Key)
+	server.GlobalCloudEventsServer.DeleteMonitor(m.Key)
 
 	return nil
 }
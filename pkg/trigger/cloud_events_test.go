@@ -0,0 +1,43 @@
+package trigger
+
+import (
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCloudEventsMatch(t *testing.T) {
+	_, err := NewCloudEventsTrigger(map[string]string{"extensions": "tenant"})
+	assert.NotNil(t, err)
+
+	m, err := NewCloudEventsTrigger(map[string]string{
+		"sourcePrefix": "/shop/",
+		"typeSuffix":   ".created",
+		"extensions":   "Tenant=a,priority=1",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"tenant": "a", "priority": "1"}, m.Opts.Extensions)
+
+	e := cloudevents.NewEvent()
+	e.SetID("1")
+	e.SetSource("/shop/orders")
+	e.SetType("order.created")
+	e.SetExtension("tenant", "a")
+	e.SetExtension("priority", 1)
+	assert.True(t, m.Match(e))
+
+	e.SetExtension("tenant", "b")
+	assert.False(t, m.Match(e))
+	e.SetExtension("tenant", "a")
+	e.SetType("order.deleted")
+	assert.False(t, m.Match(e))
+	e.SetType("order.created")
+	e.SetSource("/inventory")
+	assert.False(t, m.Match(e))
+
+	m, err = NewCloudEventsTrigger(map[string]string{"source": "/inventory", "type": "item.updated"})
+	assert.Nil(t, err)
+	assert.False(t, m.Match(e))
+	e.SetType("item.updated")
+	assert.True(t, m.Match(e))
+}
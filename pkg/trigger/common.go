@@ -3,9 +3,35 @@ package trigger
 import (
 	"context"
 	"eventrigger.com/operator/common/event"
+	"time"
 )
 
 type Interface interface {
 	Run(ctx context.Context, eventChannel chan event.Event) error
 	Stop() error
 }
+
+// ScaleMetric is the metric a trigger scales actor replicas by
+type ScaleMetric struct {
+	// Value is the current metric value, e.g. consumer lag
+	Value int64
+	// Target is the metric value one replica handles
+	Target int64
+	// MaxReplicas caps replicas from trigger side, e.g. partitions of topic, 0 means no cap
+	MaxReplicas int32
+}
+
+// MetricInterface is implemented by triggers which scale actor by metric instead of events
+type MetricInterface interface {
+	// MetricEnabled reports whether trigger runs in scale mode
+	MetricEnabled() bool
+	// PollingInterval is how often metric is polled
+	PollingInterval() time.Duration
+	GetMetric(ctx context.Context) (*ScaleMetric, error)
+}
+
+// InFlightInterface is implemented by triggers which proxy requests to actor
+type InFlightInterface interface {
+	// InFlight is the number of requests being proxied
+	InFlight() int64
+}
@@ -0,0 +1,254 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"eventrigger.com/operator/common/consts"
+	"eventrigger.com/operator/common/event"
+	"eventrigger.com/operator/common/server"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net/http"
+	"path"
+	"strings"
+)
+
+type gitEventKind string
+
+const (
+	GitPushEvent         gitEventKind = "push"
+	GitTagEvent          gitEventKind = "tag"
+	GitMergeRequestEvent gitEventKind = "merge_request"
+)
+
+// GitEvent is webhook of github, gitlab and gitea normalized, it is data of event
+type GitEvent struct {
+	Provider string       `json:"provider"`
+	Kind     gitEventKind `json:"kind"`
+	Repo     string       `json:"repo"`
+	RepoURL  string       `json:"repo_url"`
+	Ref      string       `json:"ref"`
+	Branch   string       `json:"branch,omitempty"`
+	Tag      string       `json:"tag,omitempty"`
+	SHA      string       `json:"sha"`
+	// Action of merge request: opened, closed, merged, reopened, updated, or deleted of push
+	Action       string           `json:"action,omitempty"`
+	Author       string           `json:"author"`
+	MergeRequest *GitMergeRequest `json:"merge_request,omitempty"`
+}
+
+type GitMergeRequest struct {
+	// ID is number of pull request, or iid of gitlab merge request
+	ID           int64    `json:"id"`
+	Title        string   `json:"title"`
+	State        string   `json:"state"`
+	SourceBranch string   `json:"source_branch"`
+	TargetBranch string   `json:"target_branch"`
+	Labels       []string `json:"labels,omitempty"`
+	URL          string   `json:"url"`
+}
+
+// GitOptions filters normalized git events, empty filter passes all
+type GitOptions struct {
+	Provider webhookProvider
+	Hosts    []string
+	Paths    []string
+	// Events are kinds of events
+	Events []gitEventKind
+	// Branches are glob patterns of branch of push, or target branch of merge request
+	Branches []string
+	// Actions are actions of merge request
+	Actions []string
+	// Labels are labels merge request must have
+	Labels  []string
+	Webhook WebhookOptions
+}
+
+type GitTrigger struct {
+	Opts *GitOptions
+	// Webhook verifies signature of forge if webhookSecret is set
+	Webhook *webhookVerifier
+
+	EventChannel chan event.Event
+}
+
+func parseGitMeta(meta map[string]string) (opts *GitOptions, err error) {
+	opts = &GitOptions{
+		Provider: webhookProvider(meta["provider"]),
+	}
+	switch opts.Provider {
+	case GithubWebhook, GitlabWebhook, GiteaWebhook:
+	default:
+		return nil, errors.New(fmt.Sprintf("not support git provider %s", opts.Provider))
+	}
+	if hosts, ok := meta["hosts"]; ok {
+		opts.Hosts = strings.Split(hosts, ",")
+	}
+	if paths, ok := meta["paths"]; ok {
+		opts.Paths = strings.Split(paths, ",")
+	}
+	if len(opts.Hosts) == 0 && len(opts.Paths) == 0 {
+		return nil, errors.New("git trigger requires hosts or paths")
+	}
+	if events, ok := meta["events"]; ok {
+		for _, e := range strings.Split(events, ",") {
+			switch kind := gitEventKind(e); kind {
+			case GitPushEvent, GitTagEvent, GitMergeRequestEvent:
+				opts.Events = append(opts.Events, kind)
+			default:
+				return nil, errors.New(fmt.Sprintf("not valid git event %s", e))
+			}
+		}
+	}
+	if branches, ok := meta["branches"]; ok {
+		opts.Branches = strings.Split(branches, ",")
+		for _, b := range opts.Branches {
+			if _, err := path.Match(b, ""); err != nil {
+				return nil, errors.New(fmt.Sprintf("not valid branch pattern %s", b))
+			}
+		}
+	}
+	if actions, ok := meta["actions"]; ok {
+		opts.Actions = strings.Split(actions, ",")
+	}
+	if labels, ok := meta["labels"]; ok {
+		opts.Labels = strings.Split(labels, ",")
+	}
+	if meta["webhookSecret"] != "" {
+		webhookMeta := map[string]string{
+			"webhook":          string(opts.Provider),
+			"webhookSecret":    meta["webhookSecret"],
+			"webhookSecretKey": meta["webhookSecretKey"],
+		}
+		if opts.Webhook, err = parseWebhookMeta(webhookMeta); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+func NewGitTrigger(meta map[string]string, namespace string) (*GitTrigger, error) {
+	opts, err := parseGitMeta(meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse git meta")
+	}
+	return &GitTrigger{
+		Opts:    opts,
+		Webhook: newWebhookVerifier(opts.Webhook, namespace),
+	}, nil
+}
+
+func (m *GitTrigger) Handler(c *gin.Context) (int, interface{}, error) {
+	rawData, err := c.GetRawData()
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if err := m.Webhook.Verify(c.Request, rawData); err != nil {
+		return http.StatusUnauthorized, nil, err
+	}
+	gitEvent, err := parseGitEvent(m.Opts.Provider, c.Request.Header, rawData)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if gitEvent == nil {
+		return 0, server.HttpResponse{Msg: "event is ignored"}, nil
+	}
+	if reason, ok := m.match(gitEvent); !ok {
+		zap.L().Debug(fmt.Sprintf("git event of %s %s is filtered: %s", gitEvent.Repo, gitEvent.Ref, reason))
+		return 0, server.HttpResponse{Msg: reason}, nil
+	}
+
+	data, err := json.Marshal(gitEvent)
+	if err != nil {
+		return 0, nil, err
+	}
+	uuid := c.Request.Header.Get(consts.UUIDLabelHeader)
+	sEvent := event.NewEvent("", string(v1.GitTriggerType), gitEvent.Repo, "", string(data), uuid)
+	m.EventChannel <- sEvent
+	return 0, sEvent, nil
+}
+
+// match reports whether event passes filters, or the reason it is filtered
+func (m *GitTrigger) match(e *GitEvent) (string, bool) {
+	if len(m.Opts.Events) > 0 && !containsKind(m.Opts.Events, e.Kind) {
+		return fmt.Sprintf("event %s is not in %v", e.Kind, m.Opts.Events), false
+	}
+	if len(m.Opts.Branches) > 0 && e.Kind != GitTagEvent {
+		branch := e.Branch
+		if e.MergeRequest != nil {
+			branch = e.MergeRequest.TargetBranch
+		}
+		if !matchAny(m.Opts.Branches, branch) {
+			return fmt.Sprintf("branch %s does not match %v", branch, m.Opts.Branches), false
+		}
+	}
+	if e.Kind != GitMergeRequestEvent {
+		return "", true
+	}
+	if len(m.Opts.Actions) > 0 && !containsString(m.Opts.Actions, e.Action) {
+		return fmt.Sprintf("action %s is not in %v", e.Action, m.Opts.Actions), false
+	}
+	for _, label := range m.Opts.Labels {
+		if !containsString(e.MergeRequest.Labels, label) {
+			return fmt.Sprintf("merge request has no label %s", label), false
+		}
+	}
+	return "", true
+}
+
+func containsKind(kinds []gitEventKind, kind gitEventKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *GitTrigger) Run(ctx context.Context, eventChannel chan event.Event) error {
+	m.EventChannel = eventChannel
+	for _, host := range m.Opts.Hosts {
+		zap.L().Info(fmt.Sprintf("git trigger of %s add host: %s", m.Opts.Provider, host))
+		if err := server.GlobalHttpServer.AddOrReplaceHostMap(host, m.Handler); err != nil {
+			return errors.Wrapf(err, "add host %s", host)
+		}
+	}
+	for _, prefix := range m.Opts.Paths {
+		zap.L().Info(fmt.Sprintf("git trigger of %s add path prefix: %s", m.Opts.Provider, prefix))
+		if err := server.GlobalHttpServer.AddOrReplacePathPrefixMap(prefix, m.Handler); err != nil {
+			return errors.Wrapf(err, "add path prefix %s", prefix)
+		}
+	}
+	return nil
+}
+
+func (m *GitTrigger) Stop() error {
+	for _, host := range m.Opts.Hosts {
+		server.GlobalHttpServer.DeleteHostMap(host)
+	}
+	for _, prefix := range m.Opts.Paths {
+		server.GlobalHttpServer.DeletePathPrefixMap(prefix)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package trigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	refHeadsPrefix = "refs/heads/"
+	refTagsPrefix  = "refs/tags/"
+	zeroSHA        = "0000000000000000000000000000000000000000"
+)
+
+// parseGitEvent normalizes webhook of provider, events other than push, tag and merge request are nil
+func parseGitEvent(provider webhookProvider, header http.Header, body []byte) (*GitEvent, error) {
+	var e *GitEvent
+	var err error
+	switch provider {
+	case GithubWebhook:
+		e, err = parseGithubEvent(header.Get("X-GitHub-Event"), body)
+	case GiteaWebhook:
+		// gitea payloads are compatible with github
+		e, err = parseGithubEvent(header.Get("X-Gitea-Event"), body)
+	case GitlabWebhook:
+		e, err = parseGitlabEvent(header.Get("X-Gitlab-Event"), body)
+	default:
+		return nil, errors.New(fmt.Sprintf("not support git provider %s", provider))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s webhook", provider)
+	}
+	if e != nil {
+		e.Provider = string(provider)
+	}
+	return e, nil
+}
+
+// setRef sets kind, branch or tag of push by ref
+func (e *GitEvent) setRef(ref string) {
+	e.Ref = ref
+	switch {
+	case strings.HasPrefix(ref, refTagsPrefix):
+		e.Kind = GitTagEvent
+		e.Tag = strings.TrimPrefix(ref, refTagsPrefix)
+	default:
+		e.Kind = GitPushEvent
+		e.Branch = strings.TrimPrefix(ref, refHeadsPrefix)
+	}
+}
+
+type githubUser struct {
+	Login    string `json:"login"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+func (u githubUser) name() string {
+	for _, n := range []string{u.Login, u.Username, u.Name} {
+		if n != "" {
+			return n
+		}
+	}
+	return ""
+}
+
+type githubRepo struct {
+	FullName string `json:"full_name"`
+	HTMLURL  string `json:"html_url"`
+}
+
+type githubLabel struct {
+	Name string `json:"name"`
+}
+
+type githubPush struct {
+	Ref        string     `json:"ref"`
+	After      string     `json:"after"`
+	Deleted    bool       `json:"deleted"`
+	Repository githubRepo `json:"repository"`
+	Pusher     githubUser `json:"pusher"`
+	Sender     githubUser `json:"sender"`
+}
+
+type githubPullRequest struct {
+	Action      string     `json:"action"`
+	Number      int64      `json:"number"`
+	Repository  githubRepo `json:"repository"`
+	Sender      githubUser `json:"sender"`
+	PullRequest struct {
+		Title   string        `json:"title"`
+		State   string        `json:"state"`
+		Merged  bool          `json:"merged"`
+		HTMLURL string        `json:"html_url"`
+		Labels  []githubLabel `json:"labels"`
+		User    githubUser    `json:"user"`
+		Head    struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+func parseGithubEvent(kind string, body []byte) (*GitEvent, error) {
+	switch kind {
+	case "push":
+		var p githubPush
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		e := &GitEvent{
+			Repo:    p.Repository.FullName,
+			RepoURL: p.Repository.HTMLURL,
+			SHA:     p.After,
+			Author:  p.Pusher.name(),
+		}
+		if e.Author == "" {
+			e.Author = p.Sender.name()
+		}
+		e.setRef(p.Ref)
+		if p.Deleted || p.After == zeroSHA {
+			e.Action = "deleted"
+		}
+		return e, nil
+	case "pull_request":
+		var p githubPullRequest
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		pr := p.PullRequest
+		mr := &GitMergeRequest{
+			ID:           p.Number,
+			Title:        pr.Title,
+			State:        pr.State,
+			SourceBranch: pr.Head.Ref,
+			TargetBranch: pr.Base.Ref,
+			URL:          pr.HTMLURL,
+		}
+		for _, l := range pr.Labels {
+			mr.Labels = append(mr.Labels, l.Name)
+		}
+		action := p.Action
+		switch {
+		case action == "closed" && pr.Merged:
+			action = "merged"
+		case action == "synchronize" || action == "synchronized" || action == "edited":
+			action = "updated"
+		}
+		if pr.Merged {
+			mr.State = "merged"
+		}
+		author := pr.User.name()
+		if author == "" {
+			author = p.Sender.name()
+		}
+		return &GitEvent{
+			Kind:         GitMergeRequestEvent,
+			Repo:         p.Repository.FullName,
+			RepoURL:      p.Repository.HTMLURL,
+			Ref:          refHeadsPrefix + pr.Head.Ref,
+			Branch:       pr.Head.Ref,
+			SHA:          pr.Head.SHA,
+			Action:       action,
+			Author:       author,
+			MergeRequest: mr,
+		}, nil
+	}
+	return nil, nil
+}
+
+type gitlabProject struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+type gitlabPush struct {
+	Ref          string        `json:"ref"`
+	After        string        `json:"after"`
+	CheckoutSHA  string        `json:"checkout_sha"`
+	UserUsername string        `json:"user_username"`
+	Project      gitlabProject `json:"project"`
+}
+
+type gitlabMergeRequest struct {
+	User struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project          gitlabProject `json:"project"`
+	ObjectAttributes struct {
+		IID          int64  `json:"iid"`
+		Title        string `json:"title"`
+		State        string `json:"state"`
+		Action       string `json:"action"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		URL          string `json:"url"`
+		LastCommit   struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+	Labels []struct {
+		Title string `json:"title"`
+	} `json:"labels"`
+}
+
+// gitlabActions maps actions of gitlab merge request to those of github
+var gitlabActions = map[string]string{
+	"open":   "opened",
+	"close":  "closed",
+	"reopen": "reopened",
+	"update": "updated",
+	"merge":  "merged",
+}
+
+func parseGitlabEvent(kind string, body []byte) (*GitEvent, error) {
+	switch kind {
+	case "Push Hook", "Tag Push Hook":
+		var p gitlabPush
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		e := &GitEvent{
+			Repo:    p.Project.PathWithNamespace,
+			RepoURL: p.Project.WebURL,
+			SHA:     p.After,
+			Author:  p.UserUsername,
+		}
+		if p.CheckoutSHA != "" {
+			e.SHA = p.CheckoutSHA
+		}
+		e.setRef(p.Ref)
+		if p.After == zeroSHA {
+			e.Action = "deleted"
+		}
+		return e, nil
+	case "Merge Request Hook":
+		var p gitlabMergeRequest
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		attrs := p.ObjectAttributes
+		mr := &GitMergeRequest{
+			ID:           attrs.IID,
+			Title:        attrs.Title,
+			State:        attrs.State,
+			SourceBranch: attrs.SourceBranch,
+			TargetBranch: attrs.TargetBranch,
+			URL:          attrs.URL,
+		}
+		if mr.State == "opened" {
+			mr.State = "open"
+		}
+		for _, l := range p.Labels {
+			mr.Labels = append(mr.Labels, l.Title)
+		}
+		action := attrs.Action
+		if a, ok := gitlabActions[action]; ok {
+			action = a
+		}
+		return &GitEvent{
+			Kind:         GitMergeRequestEvent,
+			Repo:         p.Project.PathWithNamespace,
+			RepoURL:      p.Project.WebURL,
+			Ref:          refHeadsPrefix + attrs.SourceBranch,
+			Branch:       attrs.SourceBranch,
+			SHA:          attrs.LastCommit.ID,
+			Action:       action,
+			Author:       p.User.Username,
+			MergeRequest: mr,
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,118 @@
+package trigger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func gitHeader(key, value string) http.Header {
+	h := http.Header{}
+	h.Set(key, value)
+	return h
+}
+
+func TestParseGithubEvent(t *testing.T) {
+	push := `{"ref":"refs/heads/main","after":"abc","repository":{"full_name":"org/app","html_url":"https://github.com/org/app"},"pusher":{"name":"alice"}}`
+	e, err := parseGitEvent(GithubWebhook, gitHeader("X-GitHub-Event", "push"), []byte(push))
+	assert.Nil(t, err)
+	assert.Equal(t, GitPushEvent, e.Kind)
+	assert.Equal(t, "main", e.Branch)
+	assert.Equal(t, "org/app", e.Repo)
+	assert.Equal(t, "abc", e.SHA)
+	assert.Equal(t, "alice", e.Author)
+	assert.Equal(t, "github", e.Provider)
+
+	tag := `{"ref":"refs/tags/v1.0.0","after":"abc","repository":{"full_name":"org/app"},"sender":{"login":"bob"}}`
+	e, err = parseGitEvent(GithubWebhook, gitHeader("X-GitHub-Event", "push"), []byte(tag))
+	assert.Nil(t, err)
+	assert.Equal(t, GitTagEvent, e.Kind)
+	assert.Equal(t, "v1.0.0", e.Tag)
+	assert.Equal(t, "bob", e.Author)
+
+	pr := `{"action":"closed","number":7,"repository":{"full_name":"org/app"},"pull_request":{"title":"fix","state":"closed","merged":true,
+		"labels":[{"name":"deploy"}],"user":{"login":"carol"},"head":{"ref":"fix","sha":"def"},"base":{"ref":"main"}}}`
+	e, err = parseGitEvent(GithubWebhook, gitHeader("X-GitHub-Event", "pull_request"), []byte(pr))
+	assert.Nil(t, err)
+	assert.Equal(t, GitMergeRequestEvent, e.Kind)
+	assert.Equal(t, "merged", e.Action)
+	assert.Equal(t, "def", e.SHA)
+	assert.Equal(t, int64(7), e.MergeRequest.ID)
+	assert.Equal(t, "merged", e.MergeRequest.State)
+	assert.Equal(t, "main", e.MergeRequest.TargetBranch)
+	assert.Equal(t, []string{"deploy"}, e.MergeRequest.Labels)
+
+	e, err = parseGitEvent(GithubWebhook, gitHeader("X-GitHub-Event", "ping"), []byte(`{}`))
+	assert.Nil(t, err)
+	assert.Nil(t, e)
+}
+
+func TestParseGitlabAndGiteaEvent(t *testing.T) {
+	mr := `{"user":{"username":"dave"},"project":{"path_with_namespace":"group/app","web_url":"https://gitlab.com/group/app"},
+		"object_attributes":{"iid":3,"title":"feat","state":"opened","action":"open","source_branch":"feat","target_branch":"develop",
+		"last_commit":{"id":"123"}},"labels":[{"title":"review"}]}`
+	e, err := parseGitEvent(GitlabWebhook, gitHeader("X-Gitlab-Event", "Merge Request Hook"), []byte(mr))
+	assert.Nil(t, err)
+	assert.Equal(t, GitMergeRequestEvent, e.Kind)
+	assert.Equal(t, "opened", e.Action)
+	assert.Equal(t, "open", e.MergeRequest.State)
+	assert.Equal(t, int64(3), e.MergeRequest.ID)
+	assert.Equal(t, "group/app", e.Repo)
+	assert.Equal(t, []string{"review"}, e.MergeRequest.Labels)
+
+	push := `{"ref":"refs/heads/develop","after":"0000000000000000000000000000000000000000","user_username":"dave","project":{"path_with_namespace":"group/app"}}`
+	e, err = parseGitEvent(GitlabWebhook, gitHeader("X-Gitlab-Event", "Push Hook"), []byte(push))
+	assert.Nil(t, err)
+	assert.Equal(t, "develop", e.Branch)
+	assert.Equal(t, "deleted", e.Action)
+
+	gitea := `{"ref":"refs/heads/main","after":"abc","repository":{"full_name":"org/app"},"pusher":{"login":"erin"}}`
+	e, err = parseGitEvent(GiteaWebhook, gitHeader("X-Gitea-Event", "push"), []byte(gitea))
+	assert.Nil(t, err)
+	assert.Equal(t, "erin", e.Author)
+	assert.Equal(t, "gitea", e.Provider)
+}
+
+func TestGitTriggerMatch(t *testing.T) {
+	_, err := NewGitTrigger(map[string]string{"provider": "svn", "paths": "/git"}, "app")
+	assert.NotNil(t, err)
+	_, err = NewGitTrigger(map[string]string{"provider": "github"}, "app")
+	assert.NotNil(t, err)
+	_, err = NewGitTrigger(map[string]string{"provider": "github", "paths": "/git", "events": "issue"}, "app")
+	assert.NotNil(t, err)
+
+	m, err := NewGitTrigger(map[string]string{
+		"provider": "github",
+		"paths":    "/git",
+		"events":   "push,merge_request",
+		"branches": "main,release/*",
+		"actions":  "opened,updated",
+		"labels":   "deploy",
+	}, "app")
+	assert.Nil(t, err)
+	assert.Nil(t, m.Webhook)
+
+	_, ok := m.match(&GitEvent{Kind: GitPushEvent, Branch: "release/1.0"})
+	assert.True(t, ok)
+	_, ok = m.match(&GitEvent{Kind: GitPushEvent, Branch: "feature/a"})
+	assert.False(t, ok)
+	_, ok = m.match(&GitEvent{Kind: GitTagEvent, Tag: "v1"})
+	assert.False(t, ok)
+
+	mr := &GitEvent{Kind: GitMergeRequestEvent, Branch: "feature/a", Action: "opened",
+		MergeRequest: &GitMergeRequest{TargetBranch: "main", Labels: []string{"deploy"}}}
+	_, ok = m.match(mr)
+	assert.True(t, ok)
+	mr.Action = "closed"
+	_, ok = m.match(mr)
+	assert.False(t, ok)
+	mr.Action = "opened"
+	mr.MergeRequest.Labels = nil
+	_, ok = m.match(mr)
+	assert.False(t, ok)
+
+	// webhook secret is read from namespace of sensor
+	m, err = NewGitTrigger(map[string]string{"provider": "github", "paths": "/git", "webhookSecret": "hook"}, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "app", m.Webhook.Namespace)
+}
@@ -10,20 +10,28 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
+	"net/http"
 	"strings"
 )
 
 type HttpOptions struct {
-	Hosts   []string
+	Hosts []string
+	// Paths are path prefixes routed to trigger
+	Paths   []string
 	Headers map[string]string
 	Suffix  string
+	Auth    AuthOptions
+	Webhook WebhookOptions
 }
 
 type HttpMonitor struct {
 	Opts *HttpOptions
+	// Auth rejects requests without valid credentials, secrets are read from namespace of sensor
+	Auth *authenticator
+	// Webhook rejects webhooks without valid signature
+	Webhook *webhookVerifier
 
 	EventChannel chan event.Event
-	StopCh       <-chan struct{}
 }
 
 func parseHttpMeta(meta map[string]string) (opts *HttpOptions, err error) {
@@ -32,30 +40,47 @@ func parseHttpMeta(meta map[string]string) (opts *HttpOptions, err error) {
 	if hosts, ok := meta["hosts"]; ok {
 		opts.Hosts = strings.Split(hosts, ",")
 	}
+	if paths, ok := meta["paths"]; ok {
+		opts.Paths = strings.Split(paths, ",")
+	}
 	if suffix, ok := meta["suffix"]; ok {
 		opts.Suffix = suffix
 	}
 	if headerStr, ok := meta["headers"]; ok {
 		mapstructure.Decode(headerStr, opts.Headers)
 	}
+	opts.Auth, err = parseAuthMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+	opts.Webhook, err = parseWebhookMeta(meta)
+	if err != nil {
+		return nil, err
+	}
 
 	return opts, nil
 }
 
-func NewHttpMonitor(meta map[string]string) (*HttpMonitor, error) {
+func NewHttpMonitor(meta map[string]string, namespace string) (*HttpMonitor, error) {
 	opts, err := parseHttpMeta(meta)
 	if err != nil {
 		return nil, errors.Wrap(err, "parse http meta")
 	}
 
 	m := &HttpMonitor{
-		Opts: opts,
+		Opts:    opts,
+		Auth:    newAuthenticator(opts.Auth, namespace),
+		Webhook: newWebhookVerifier(opts.Webhook, namespace),
 	}
 
 	return m, nil
 }
 
 func (m *HttpMonitor) Handler(c *gin.Context) (int, interface{}, error) {
+	if err := m.Auth.Authenticate(c.Request); err != nil {
+		c.Header("WWW-Authenticate", m.Auth.Challenge())
+		return http.StatusUnauthorized, nil, err
+	}
 	// send event to actor
 	uuid := c.Request.Header.Get(consts.UUIDLabelHeader)
 	var data string
@@ -65,20 +90,39 @@ func (m *HttpMonitor) Handler(c *gin.Context) (int, interface{}, error) {
 	} else {
 		data = string(rawData)
 	}
+	if err := m.Webhook.Verify(c.Request, rawData); err != nil {
+		return http.StatusUnauthorized, nil, err
+	}
 	sEvent := event.NewEvent("", string(v1.HttpTriggerType), "", "", data, uuid)
 	m.EventChannel <- sEvent
 	return 0, sEvent, nil
 }
 
-func (m *HttpMonitor) Run(ctx context.Context, eventChannel chan event.Event, stopCh <-chan struct{}) error {
+func (m *HttpMonitor) Run(ctx context.Context, eventChannel chan event.Event) error {
 	m.EventChannel = eventChannel
-	m.StopCh = stopCh
 	for _, host := range m.Opts.Hosts {
 		server.GlobalHttpServer.AddOrReplaceHostMap(host, m.Handler)
 	}
+	for _, prefix := range m.Opts.Paths {
+		server.GlobalHttpServer.AddOrReplacePathPrefixMap(prefix, m.Handler)
+	}
+	for k, v := range m.Opts.Headers {
+		header := fmt.Sprintf("%s=%s", k, v)
+		server.GlobalHttpServer.AddOrReplaceHeaderMap(header, m.Handler)
+	}
+	return nil
+}
+
+func (m *HttpMonitor) Stop() error {
+	for _, host := range m.Opts.Hosts {
+		server.GlobalHttpServer.DeleteHostMap(host)
+	}
+	for _, prefix := range m.Opts.Paths {
+		server.GlobalHttpServer.DeletePathPrefixMap(prefix)
+	}
 	for k, v := range m.Opts.Headers {
 		header := fmt.Sprintf("%s=%s", k, v)
-		server.GlobalHttpServer.AddOrReplaceHostMap(header, m.Handler)
+		server.GlobalHttpServer.DeleteHeaderMap(header)
 	}
 	return nil
 }
@@ -3,45 +3,115 @@ package trigger
 import (
 	"context"
 	"eventrigger.com/operator/common/event"
+	"eventrigger.com/operator/common/k8s"
 	"eventrigger.com/operator/common/server"
 	"fmt"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"path"
+	"regexp"
+	"strings"
 )
 
+// K8sEventsOptions filters core/v1 events, empty option passes all
 type K8sEventsOptions struct {
-	Namespace  string
+	// Namespace is namespace of sensor by default, * subscribes all namespaces
+	Namespace string
+	// Type is Normal or Warning
+	Type string
+	// APIVersion and Kind are of involved object, like v1 and Pod
 	APIVersion string
-	Type       string
 	Kind       string
+	// Name is name or glob pattern of involved object
+	Name string
+	// Labels is label selector of involved object, which is looked up by informer, it requires Kind
+	Labels string
+	// Reasons are reasons like BackOff,Failed
+	Reasons string
+	// Message is regexp message must match
+	Message string
+	// ReportingController is reporting controller or source component like kubelet
+	ReportingController string
+	MinCount            int32
 }
 
 type K8sEventsTrigger struct {
 	Opts         *K8sEventsOptions
 	Key          string
 	EventChannel *chan event.Event
+
+	reasons []string
+	message *regexp.Regexp
+	// objects caches involved objects matching Labels
+	objects cache.GenericLister
+	stopCh  chan struct{}
 }
 
-func parseK8sEventsMeta(meta map[string]string) (opts *K8sEventsOptions, err error) {
+func parseK8sEventsMeta(meta map[string]string, namespace string) (opts *K8sEventsOptions, err error) {
 	opts = &K8sEventsOptions{}
 
-	err = mapstructure.Decode(meta, opts)
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{WeaklyTypedInput: true, Result: opts})
+	if err != nil {
+		return nil, errors.Wrap(err, "new meta decoder")
+	}
+	err = decoder.Decode(meta)
 	if err != nil {
 		return nil, errors.Wrap(err, "parse k8s events trigger")
 	}
+	if opts.Namespace == "" {
+		opts.Namespace = namespace
+	}
+	if opts.Namespace != namespace && !AllowCrossNamespaceWatch {
+		return nil, errors.New(fmt.Sprintf("k8s events trigger of namespace %s cannot subscribe namespace %s", namespace, opts.Namespace))
+	}
+	if opts.Name != "" {
+		if _, err := path.Match(opts.Name, ""); err != nil {
+			return nil, errors.New(fmt.Sprintf("not valid name pattern %s", opts.Name))
+		}
+	}
+	if opts.Labels != "" {
+		if opts.Kind == "" {
+			return nil, errors.New("labels of involved object requires kind")
+		}
+		if _, err := labels.Parse(opts.Labels); err != nil {
+			return nil, errors.Wrapf(err, "not valid label selector %s", opts.Labels)
+		}
+	}
 
 	return opts, nil
 }
 
-func NewK8sEventsTrigger(meta map[string]string) (*K8sEventsTrigger, error) {
-	opts, err := parseK8sEventsMeta(meta)
+// NewK8sEventsTrigger subscribes events of namespace of sensor unless cross namespace watch is allowed
+func NewK8sEventsTrigger(meta map[string]string, namespace string) (*K8sEventsTrigger, error) {
+	opts, err := parseK8sEventsMeta(meta, namespace)
 	if err != nil {
 		return nil, err
 	}
 	m := &K8sEventsTrigger{
 		Opts: opts,
-		Key:  server.UniqueK8sEventKey(opts.Kind, opts.Type, opts.APIVersion, opts.Namespace),
+		// triggers of same options are different subscribers
+		Key: server.UniqueK8sEventKey(opts.Kind, opts.Type, opts.APIVersion, opts.Namespace) + "-" + string(uuid.NewUUID()),
+	}
+	if opts.Reasons != "" {
+		m.reasons = strings.Split(opts.Reasons, ",")
+	}
+	if opts.Message != "" {
+		m.message, err = regexp.Compile(opts.Message)
+		if err != nil {
+			return nil, errors.Wrapf(err, "not valid message regexp %s", opts.Message)
+		}
 	}
 
 	return m, nil
@@ -49,13 +119,139 @@ func NewK8sEventsTrigger(meta map[string]string) (*K8sEventsTrigger, error) {
 
 func (m *K8sEventsTrigger) Run(ctx context.Context, eventChannel chan event.Event) error {
 	m.EventChannel = &eventChannel
-	server.GlobalK8sEventsMonitor.UpdateMonitor(m.Key, &eventChannel)
+	if m.Opts.Labels != "" {
+		if err := m.watchObjects(); err != nil {
+			return errors.Wrapf(err, "watch %s of labels %s", m.Opts.Kind, m.Opts.Labels)
+		}
+	}
+	if err := server.GlobalK8sEventsMonitor.UpdateMonitor(m.Key, m.subscriber(&eventChannel)); err != nil {
+		m.Stop()
+		return errors.Wrap(err, "subscribe k8s events")
+	}
 	zap.L().Debug(fmt.Sprintf("k8s events trigger add monitor with event: %s exist", m.Key))
 	return nil
 }
 
+// subscriber pushes down namespace, type and single reason to informer of events
+func (m *K8sEventsTrigger) subscriber(eventChannel *chan event.Event) server.K8sEventsSubscriber {
+	subscriber := server.K8sEventsSubscriber{
+		Channel:   eventChannel,
+		Match:     m.Match,
+		Namespace: m.namespace(),
+		Type:      m.Opts.Type,
+	}
+	if len(m.reasons) == 1 {
+		subscriber.Reason = m.reasons[0]
+	}
+	return subscriber
+}
+
+// namespace is namespace of informers, empty means all namespaces
+func (m *K8sEventsTrigger) namespace() string {
+	if m.Opts.Namespace == WatchAllNamespaces {
+		return metav1.NamespaceAll
+	}
+	return m.Opts.Namespace
+}
+
+// watchObjects starts informer of involved objects matching labels, so that events can be matched by cache
+func (m *K8sEventsTrigger) watchObjects() error {
+	cfg, err := k8s.GetKubeConfig()
+	if err != nil {
+		return err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "new discovery client")
+	}
+	gv, err := schema.ParseGroupVersion(m.Opts.APIVersion)
+	if err != nil {
+		return errors.Wrapf(err, "parse api version %s", m.Opts.APIVersion)
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	var versions []string
+	if gv.Version != "" {
+		versions = append(versions, gv.Version)
+	}
+	mapping, err := mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: m.Opts.Kind}, versions...)
+	if err != nil {
+		return errors.Wrap(err, "map kind to resource")
+	}
+	cli, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "new dynamic client")
+	}
+
+	m.stopCh = make(chan struct{})
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(cli, 0, m.namespace(), func(o *metav1.ListOptions) {
+		o.LabelSelector = m.Opts.Labels
+	})
+	informer := factory.ForResource(mapping.Resource)
+	factory.Start(m.stopCh)
+	if !cache.WaitForCacheSync(m.stopCh, informer.Informer().HasSynced) {
+		return errors.New("wait for cache of involved objects to sync")
+	}
+	m.objects = informer.Lister()
+	return nil
+}
+
+// Match reports whether event passes filters
+func (m *K8sEventsTrigger) Match(e *corev1.Event) bool {
+	obj := e.InvolvedObject
+	if namespace := m.namespace(); namespace != "" && e.Namespace != namespace {
+		return false
+	}
+	if m.Opts.Type != "" && e.Type != m.Opts.Type {
+		return false
+	}
+	if m.Opts.Kind != "" && obj.Kind != m.Opts.Kind {
+		return false
+	}
+	if m.Opts.APIVersion != "" && obj.APIVersion != m.Opts.APIVersion {
+		return false
+	}
+	if m.Opts.Name != "" {
+		if ok, _ := path.Match(m.Opts.Name, obj.Name); !ok {
+			return false
+		}
+	}
+	if len(m.reasons) > 0 && !containsString(m.reasons, e.Reason) {
+		return false
+	}
+	if m.message != nil && !m.message.MatchString(e.Message) {
+		return false
+	}
+	if m.Opts.ReportingController != "" && e.ReportingController != m.Opts.ReportingController &&
+		e.Source.Component != m.Opts.ReportingController {
+		return false
+	}
+	count := e.Count
+	if e.Series != nil && e.Series.Count > count {
+		count = e.Series.Count
+	}
+	if count < m.Opts.MinCount {
+		return false
+	}
+	if m.objects != nil {
+		var err error
+		if obj.Namespace == "" {
+			_, err = m.objects.Get(obj.Name)
+		} else {
+			_, err = m.objects.ByNamespace(obj.Namespace).Get(obj.Name)
+		}
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
 func (m *K8sEventsTrigger) Stop() error {
 	server.GlobalK8sEventsMonitor.DeleteMonitor(m.Key)
+	if m.stopCh != nil {
+		close(m.stopCh)
+		m.stopCh = nil
+	}
 
 	return nil
 }
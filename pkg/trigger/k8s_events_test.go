@@ -0,0 +1,119 @@
+package trigger
+
+import (
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"testing"
+)
+
+func backOffEvent(name string, count int32) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: name + ".1", Namespace: "default"},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Name:       name,
+			Namespace:  "default",
+		},
+		Type:    corev1.EventTypeWarning,
+		Reason:  "BackOff",
+		Message: "Back-off restarting failed container",
+		Count:   count,
+		Source:  corev1.EventSource{Component: "kubelet"},
+	}
+}
+
+func TestParseK8sEventsMeta(t *testing.T) {
+	_, err := NewK8sEventsTrigger(map[string]string{"Labels": "app=x"}, "default")
+	assert.NotNil(t, err)
+	_, err = NewK8sEventsTrigger(map[string]string{"message": "("}, "default")
+	assert.NotNil(t, err)
+	_, err = NewK8sEventsTrigger(map[string]string{"minCount": "x"}, "default")
+	assert.NotNil(t, err)
+
+	m, err := NewK8sEventsTrigger(map[string]string{"kind": "Pod", "minCount": "3", "reasons": "BackOff,Failed"}, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), m.Opts.MinCount)
+	assert.Equal(t, []string{"BackOff", "Failed"}, m.reasons)
+
+	other, err := NewK8sEventsTrigger(map[string]string{"kind": "Pod", "minCount": "3", "reasons": "BackOff,Failed"}, "default")
+	assert.Nil(t, err)
+	assert.NotEqual(t, m.Key, other.Key)
+}
+
+func TestK8sEventsScope(t *testing.T) {
+	m, err := NewK8sEventsTrigger(map[string]string{"kind": "Pod"}, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "app", m.subscriber(nil).Namespace)
+	assert.False(t, m.Match(backOffEvent("app-1", 1)))
+
+	_, err = NewK8sEventsTrigger(map[string]string{"namespace": "default"}, "app")
+	assert.NotNil(t, err)
+	_, err = NewK8sEventsTrigger(map[string]string{"namespace": WatchAllNamespaces}, "app")
+	assert.NotNil(t, err)
+
+	AllowCrossNamespaceWatch = true
+	defer func() { AllowCrossNamespaceWatch = false }()
+	m, err = NewK8sEventsTrigger(map[string]string{"namespace": WatchAllNamespaces}, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "", m.subscriber(nil).Namespace)
+	assert.True(t, m.Match(backOffEvent("app-1", 1)))
+}
+
+func TestK8sEventsMatch(t *testing.T) {
+	m, err := NewK8sEventsTrigger(map[string]string{
+		"namespace":           "default",
+		"type":                "Warning",
+		"kind":                "Pod",
+		"name":                "app-*",
+		"reasons":             "BackOff",
+		"message":             "^Back-off",
+		"reportingController": "kubelet",
+		"minCount":            "2",
+	}, "default")
+	assert.Nil(t, err)
+
+	assert.True(t, m.Match(backOffEvent("app-1", 2)))
+	assert.False(t, m.Match(backOffEvent("app-1", 1)))
+	assert.False(t, m.Match(backOffEvent("db-1", 2)))
+
+	e := backOffEvent("app-1", 1)
+	e.Series = &corev1.EventSeries{Count: 5}
+	assert.True(t, m.Match(e))
+
+	e = backOffEvent("app-1", 2)
+	e.Reason = "Pulled"
+	assert.False(t, m.Match(e))
+	e = backOffEvent("app-1", 2)
+	e.Message = "Started container"
+	assert.False(t, m.Match(e))
+	e = backOffEvent("app-1", 2)
+	e.Source.Component = ""
+	e.ReportingController = "kubelet"
+	assert.True(t, m.Match(e))
+	e.ReportingController = "scheduler"
+	assert.False(t, m.Match(e))
+	e = backOffEvent("app-1", 2)
+	e.InvolvedObject.Kind = "Deployment"
+	assert.False(t, m.Match(e))
+}
+
+func TestK8sEventsMatchLabels(t *testing.T) {
+	m, err := NewK8sEventsTrigger(map[string]string{"kind": "Pod", "labels": "app=x"}, "default")
+	assert.Nil(t, err)
+
+	// cache of informer only has objects matching labels
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	pod := &unstructured.Unstructured{}
+	pod.SetName("app-1")
+	pod.SetNamespace("default")
+	assert.Nil(t, indexer.Add(pod))
+	m.objects = cache.NewGenericLister(indexer, schema.GroupResource{Resource: "pods"})
+
+	assert.True(t, m.Match(backOffEvent("app-1", 1)))
+	assert.False(t, m.Match(backOffEvent("app-2", 1)))
+}
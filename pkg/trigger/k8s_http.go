@@ -17,26 +17,46 @@ import (
 	"go.uber.org/zap"
 	"io/ioutil"
 	v13 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
-	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+const defaultColdStartTimeout = 300
+
 type K8sHttpOptions struct {
-	Hosts   []string
+	// Hosts may be exact or wildcard like *.example.com
+	Hosts []string
+	// Paths are path prefixes routed to trigger
+	Paths   []string
 	Headers map[string]string
 	Suffix  string
+	// ColdStartTimeout is second a request waits for the first ready endpoint
+	ColdStartTimeout int
+	// load balancing across ready endpoints
+	LBPolicy     lbPolicy
+	HashHeader   string
+	Retries      int
+	EjectSeconds int
+	// ActivatorQueueSize is max requests held during cold start
+	ActivatorQueueSize int
+	// TLSSecret and ClientCASecret serve hosts on tls listener, they are names of secrets in namespace of sensor
+	TLSSecret      string
+	ClientCASecret string
+	Auth           AuthOptions
 }
 
 type K8sHttpTrigger struct {
 	Ctx  context.Context
 	Opts *K8sHttpOptions
+	// Namespace of sensor, secrets are read from it
+	Namespace string
 	// endpoint
 	Operation         v1.KubernetesResourceOperation
 	MatchLabels       map[string]string
@@ -45,26 +65,82 @@ type K8sHttpTrigger struct {
 	EndpointType      string
 	//
 	EventChannel chan event.Event
-	Retry        int
+	Balancer     *balancer
+	Activator    *activator
+	// Auth rejects requests without valid credentials before waking up endpoints
+	Auth *authenticator
+
+	inFlight int64
+	// watching is set while pods of endpoint namespace are cached for the trigger
+	watching bool
 }
 
 func parseK8sHttpMeta(meta map[string]string) (opts *K8sHttpOptions, err error) {
-	opts = &K8sHttpOptions{}
+	opts = &K8sHttpOptions{
+		ColdStartTimeout: defaultColdStartTimeout,
+		Retries:          defaultRetries,
+		EjectSeconds:     defaultEjectSeconds,
+
+		ActivatorQueueSize: defaultActivatorQueueSize,
+	}
 
 	if hosts, ok := meta["hosts"]; ok {
 		opts.Hosts = strings.Split(hosts, ",")
 	}
+	if paths, ok := meta["paths"]; ok {
+		opts.Paths = strings.Split(paths, ",")
+	}
 	if suffix, ok := meta["suffix"]; ok {
 		opts.Suffix = suffix
 	}
 	if headerStr, ok := meta["headers"]; ok {
 		mapstructure.Decode(headerStr, opts.Headers)
 	}
+	if timeout, ok := meta["coldStartTimeout"]; ok {
+		opts.ColdStartTimeout, err = strconv.Atoi(timeout)
+		if err != nil || opts.ColdStartTimeout <= 0 {
+			return nil, errors.New(fmt.Sprintf("not valid coldStartTimeout %s", timeout))
+		}
+	}
+	opts.LBPolicy = lbPolicy(meta["lbPolicy"])
+	opts.HashHeader = meta["hashHeader"]
+	if retries, ok := meta["retries"]; ok {
+		opts.Retries, err = strconv.Atoi(retries)
+		if err != nil || opts.Retries < 0 {
+			return nil, errors.New(fmt.Sprintf("not valid retries %s", retries))
+		}
+	}
+	if size, ok := meta["activatorQueueSize"]; ok {
+		opts.ActivatorQueueSize, err = strconv.Atoi(size)
+		if err != nil || opts.ActivatorQueueSize <= 0 {
+			return nil, errors.New(fmt.Sprintf("not valid activatorQueueSize %s", size))
+		}
+	}
+	opts.TLSSecret = meta["tlsSecret"]
+	opts.ClientCASecret = meta["clientCASecret"]
+	for key, name := range map[string]string{"tlsSecret": opts.TLSSecret, "clientCASecret": opts.ClientCASecret} {
+		if err := validSecretName(key, name); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ClientCASecret != "" && opts.TLSSecret == "" {
+		return nil, errors.New("clientCASecret requires tlsSecret")
+	}
+	if eject, ok := meta["ejectSeconds"]; ok {
+		opts.EjectSeconds, err = strconv.Atoi(eject)
+		if err != nil || opts.EjectSeconds < 0 {
+			return nil, errors.New(fmt.Sprintf("not valid ejectSeconds %s", eject))
+		}
+	}
+	opts.Auth, err = parseAuthMeta(meta)
+	if err != nil {
+		return nil, err
+	}
 
 	return opts, nil
 }
 
-func NewK8sHttpTrigger(meta map[string]string, actor *v1.Actor) (*K8sHttpTrigger, error) {
+func NewK8sHttpTrigger(meta map[string]string, actor *v1.Actor, namespace string) (*K8sHttpTrigger, error) {
 	if actor == nil || actor.Template == nil || actor.Template.K8s == nil || actor.Template.K8s.Source == nil ||
 		actor.Template.K8s.Source.Resource == nil {
 		return nil, errors.New("http monitor only support k8s source and cannot be null")
@@ -90,10 +166,20 @@ func NewK8sHttpTrigger(meta map[string]string, actor *v1.Actor) (*K8sHttpTrigger
 
 	m := &K8sHttpTrigger{
 		Opts:              opts,
+		Namespace:         namespace,
 		EndpointNamespace: obj.GetNamespace(),
-		Retry:             10,
 		Operation:         op,
 	}
+	// resources of actor default to namespace of sensor
+	if m.EndpointNamespace == "" {
+		m.EndpointNamespace = namespace
+	}
+	m.Balancer, err = newBalancer(opts.LBPolicy, opts.HashHeader, time.Duration(opts.EjectSeconds)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	m.Activator = newActivator(opts.ActivatorQueueSize, time.Duration(opts.ColdStartTimeout)*time.Second)
+	m.Auth = newAuthenticator(opts.Auth, m.Namespace)
 
 	switch obj.GetKind() {
 	case consts.PodKind:
@@ -124,19 +210,29 @@ func NewK8sHttpTrigger(meta map[string]string, actor *v1.Actor) (*K8sHttpTrigger
 }
 
 func (m *K8sHttpTrigger) Handler(c *gin.Context) (code int, resp interface{}, err error) {
-	// send event to actor
+	if err := m.Auth.Authenticate(c.Request); err != nil {
+		c.Header("WWW-Authenticate", m.Auth.Challenge())
+		return http.StatusUnauthorized, nil, err
+	}
+	atomic.AddInt64(&m.inFlight, 1)
+	defer atomic.AddInt64(&m.inFlight, -1)
+
+	// send event to actor, body of streaming request is proxied without being event data
 	var data string
-	rawData, err := c.GetRawData()
-	if err != nil {
-		data = ""
-	} else {
-		data = string(rawData)
+	var rawData []byte
+	stream := isStreaming(c.Request)
+	if !stream {
+		rawData, err = c.GetRawData()
+		if err != nil {
+			data = ""
+		} else {
+			data = string(rawData)
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(rawData))
 	}
-	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(rawData))
 
 	requestUUID := c.Request.Header.Get(consts.UUIDLabelHeader)
 	sendEvent := event.NewEvent("", string(v1.HttpTriggerType), "", "", data, requestUUID)
-	m.EventChannel <- sendEvent
 
 	eventData, err := json2.Marshal(sendEvent)
 	if err != nil {
@@ -144,19 +240,38 @@ func (m *K8sHttpTrigger) Handler(c *gin.Context) (code int, resp interface{}, er
 	}
 	b64Event := base64.StdEncoding.EncodeToString(eventData)
 	zap.L().Debug(fmt.Sprintf("receive request and generate event %+v", sendEvent))
-	endpoint, err := m.GetEndpointUrl()
-	if endpoint != "" && err == nil {
+	// during cold start only the first request sends event to scale up, the others are held by activator
+	endpoints, activated, err := m.GetEndpoints(c.Request.Context(), func() { m.EventChannel <- sendEvent })
+	if err == nil && !activated {
+		m.EventChannel <- sendEvent
+	}
+	if err == nil {
 		director := func(req *http.Request) {
 			req.URL.Scheme = "http"
-			req.URL.Host = endpoint
+			// host is set to endpoint picked by balancer in transport
+			req.URL.Host = endpoints[0].Address
 			req.URL.Path = c.Request.URL.Path
 			// auto add event content
 			// todo: maybe set header、query or post form
 			req.Header.Add(consts.EVENTB64Header, b64Event)
 		}
 
+		base := http.DefaultTransport
+		if c.Request.ProtoMajor == 2 && isGrpc(c.Request) {
+			base = h2cTransport
+		}
 		proxy := &httputil.ReverseProxy{
 			Director: director,
+			Transport: &lbTransport{
+				balancer:  m.Balancer,
+				endpoints: endpoints,
+				body:      rawData,
+				stream:    stream,
+				retries:   m.Opts.Retries,
+				base:      base,
+			},
+			// flush immediately for streaming responses like server sent events and grpc
+			FlushInterval: -1,
 		}
 		proxy.ModifyResponse = func(response *http.Response) error {
 			fmt.Printf("response %s \n", response.Header)
@@ -175,7 +290,7 @@ func (m *K8sHttpTrigger) Handler(c *gin.Context) (code int, resp interface{}, er
 			}
 			return
 		}
-		zap.L().Info(fmt.Sprintf("redirect req to host %s, path %s, headers %s", endpoint, c.Request.URL.Path, c.Request.Header))
+		zap.L().Info(fmt.Sprintf("redirect req to %d endpoints, path %s, headers %s", len(endpoints), c.Request.URL.Path, c.Request.Header))
 		// todo: return serve http response to response
 		proxy.ServeHTTP(c.Writer, c.Request)
 
@@ -183,90 +298,58 @@ func (m *K8sHttpTrigger) Handler(c *gin.Context) (code int, resp interface{}, er
 	} else {
 		msg := fmt.Sprintf("failed to find endpoint with err %s", err)
 		zap.L().Info(msg)
-		return 500, msg, err
+		c.Header("Retry-After", strconv.Itoa(activatorRetryAfter))
+		return http.StatusServiceUnavailable, msg, err
 	}
 
 }
 
-func (m *K8sHttpTrigger) GetEndpointUrl() (string, error) {
-	cfg, err := k8s2.GetKubeConfig()
-	if err != nil {
-		err = errors.Wrap(err, "get kube config for get endpoint url")
-		return "", err
-	}
-
-	cli, err := kubernetes.NewForConfig(cfg)
-	if err != nil {
-		err = errors.Wrap(err, "new k8s cli with config")
-		return "", err
-	}
-
-	labelSelector := labels.Set(m.MatchLabels).AsSelector()
-	watchOptions := v12.ListOptions{LabelSelector: labelSelector.String()}
-	zap.L().Debug(fmt.Sprintf("get http endpoint url with labels %s in ns %s", labelSelector.String(), m.EndpointNamespace))
-	timeoutTicker := time.NewTicker(5 * time.Minute)
+// InFlight is the number of requests being handled
+func (m *K8sHttpTrigger) InFlight() int64 {
+	return atomic.LoadInt64(&m.inFlight)
+}
 
+// GetEndpoints resolves ready endpoints from shared endpoint cache, while there is none the request is held
+// by activator up to ColdStartTimeout and activate is called once per cold start
+func (m *K8sHttpTrigger) GetEndpoints(ctx context.Context, activate func()) ([]server.Endpoint, bool, error) {
 	switch m.EndpointType {
 	case consts.PodKind, consts.StatefulSetKind, consts.DeploymentKind:
-		watcher, err := cli.CoreV1().Pods(m.EndpointNamespace).Watch(m.Ctx, watchOptions)
-		if err != nil {
-			err = errors.Wrapf(err, "k8s watcher pod with labels %s", labelSelector.String())
-			return "", err
-		}
-		defer watcher.Stop()
-		for {
-			select {
-			case event := <-watcher.ResultChan():
-				p, ok := event.Object.(*corev1.Pod)
-				if !ok {
-					break
-				}
-				if len(p.Status.ContainerStatuses) == 0 {
-					break
-				}
-				ready := true
-				for _, sta := range p.Status.ContainerStatuses {
-					if !sta.Ready {
-						ready = false
-					}
-				}
-				if ready {
-					var port int32
-					for _, c := range p.Spec.Containers {
-						for _, pp := range c.Ports {
-							if port == 0 {
-								port = pp.ContainerPort
-							}
-							if p.Name == "http" {
-								port = pp.ContainerPort
-							}
-						}
-					}
-					if p.Status.PodIP == "" {
-						zap.L().Error(fmt.Sprintf("faile to get podIP for pod %s/%s", p.Name, p.Namespace))
-					}
-					return fmt.Sprintf("%s:%d", p.Status.PodIP, port), nil
-				}
-			case <-timeoutTicker.C:
-				return "", errors.New(fmt.Sprintf("waiting pod %s, %s select %s to be ready timeout", m.EndpointType, m.EndpointNamespace, m.MatchLabels))
-			}
-		}
 	default:
-		return "", errors.New(fmt.Sprintf("endpoint type %s not support", m.EndpointType))
+		return nil, false, errors.New(fmt.Sprintf("endpoint type %s not support", m.EndpointType))
+	}
+	selector := labels.Set(m.MatchLabels).AsSelector()
+	zap.L().Debug(fmt.Sprintf("get http endpoint url with labels %s in ns %s", selector.String(), m.EndpointNamespace))
+	endpoints, activated, err := m.Activator.Endpoints(ctx, m.EndpointNamespace, selector, activate)
+	if err != nil {
+		return nil, activated, errors.Wrapf(err, "get endpoint of %s", m.EndpointType)
 	}
+	return endpoints, activated, nil
 }
 
 func (m *K8sHttpTrigger) Run(ctx context.Context, eventChannel chan event.Event) error {
 	m.Ctx = ctx
 	m.EventChannel = eventChannel
+	if err := server.GlobalEndpointCache.Watch(ctx, m.EndpointNamespace); err != nil {
+		return errors.Wrapf(err, "watch pods of namespace %s", m.EndpointNamespace)
+	}
+	m.watching = true
 	for _, host := range m.Opts.Hosts {
 		zap.L().Info(fmt.Sprintf("k8s http monitor add host: %s for %s", host, m.EndpointType))
 		server.GlobalHttpServer.AddOrReplaceHostMap(host, m.Handler)
 	}
+	if m.Opts.TLSSecret != "" {
+		for _, host := range m.Opts.Hosts {
+			server.GlobalHttpServer.AddTLSHost(host, m.hostTLS())
+		}
+	}
+	for _, prefix := range m.Opts.Paths {
+		zap.L().Info(fmt.Sprintf("k8s http monitor add path prefix: %s for %s", prefix, m.EndpointType))
+		server.GlobalHttpServer.AddOrReplacePathPrefixMap(prefix, m.Handler)
+	}
 	for k, v := range m.Opts.Headers {
 		header := fmt.Sprintf("%s=%s", k, v)
 		zap.L().Info(fmt.Sprintf("k8s http monitor add header: %s for %s", header, m.EndpointType))
-		server.GlobalHttpServer.AddOrReplaceHostMap(header, m.Handler)
+		server.GlobalHttpServer.AddOrReplaceHeaderMap(header, m.Handler)
 	}
 
 	zap.L().Debug(fmt.Sprintf("k8s http monitor with hosts: %s exist", m.Opts.Hosts))
@@ -276,10 +359,35 @@ func (m *K8sHttpTrigger) Run(ctx context.Context, eventChannel chan event.Event)
 func (m *K8sHttpTrigger) Stop() error {
 	for _, host := range m.Opts.Hosts {
 		server.GlobalHttpServer.DeleteHostMap(host)
+		server.GlobalHttpServer.DeleteTLSHost(host)
+	}
+	for _, prefix := range m.Opts.Paths {
+		server.GlobalHttpServer.DeletePathPrefixMap(prefix)
 	}
 	for k, v := range m.Opts.Headers {
 		header := fmt.Sprintf("%s=%s", k, v)
 		server.GlobalHttpServer.DeleteHeaderMap(header)
 	}
+	if m.watching {
+		server.GlobalEndpointCache.Unwatch(m.EndpointNamespace)
+		m.watching = false
+	}
+	return nil
+}
+
+// hostTLS is tls of hosts with secrets of sensor namespace
+func (m *K8sHttpTrigger) hostTLS() server.HostTLS {
+	return server.HostTLS{Namespace: m.Namespace, Secret: m.Opts.TLSSecret, ClientCASecret: m.Opts.ClientCASecret}
+}
+
+// validSecretName checks secret of meta is a name, secrets of other namespaces cannot be referred
+func validSecretName(key, name string) error {
+	if name == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return errors.New(fmt.Sprintf("not valid %s %s, it should be name of secret in namespace of sensor: %s",
+			key, name, strings.Join(errs, "; ")))
+	}
 	return nil
 }
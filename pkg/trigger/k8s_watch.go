@@ -0,0 +1,352 @@
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"eventrigger.com/operator/common/event"
+	"eventrigger.com/operator/common/k8s"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/jsonpath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	WatchAdd    = "add"
+	WatchUpdate = "update"
+	WatchDelete = "delete"
+
+	WatchObjectPayload = "object"
+	WatchDiffPayload   = "diff"
+
+	// WatchAllNamespaces is namespace of watches across namespaces and of cluster scoped resources
+	WatchAllNamespaces = "*"
+)
+
+var (
+	// AllowCrossNamespaceWatch lets k8s_watch and k8s_events triggers watch namespaces other than namespace of sensor,
+	// it is set by operator flag since operator reads all namespaces on behalf of sensors
+	AllowCrossNamespaceWatch = false
+
+	// deniedWatchResources cannot be watched, events would carry their content to anyone creating sensors
+	deniedWatchResources = []schema.GroupResource{
+		{Group: "", Resource: "secrets"},
+	}
+)
+
+// WatchEvent is data of event, Object is set by object payload and Diff is set by diff payload
+type WatchEvent struct {
+	Action    string                 `json:"action"`
+	Name      string                 `json:"name"`
+	Namespace string                 `json:"namespace,omitempty"`
+	Object    map[string]interface{} `json:"object,omitempty"`
+	// Diff is json merge patch from old object to new one, null fields are removed
+	Diff map[string]interface{} `json:"diff,omitempty"`
+}
+
+type K8sWatchOptions struct {
+	GVR schema.GroupVersionResource
+	// Namespace is namespace of sensor by default, * watches all namespaces
+	Namespace     string
+	LabelSelector string
+	FieldSelector string
+	// Events are actions to fire on, all by default
+	Events []string
+	// FieldPaths are jsonpaths like {.spec.replicas}, update fires only if one of them changed
+	FieldPaths []*jsonpath.JSONPath
+	// FieldValue limits FieldPaths changes to those whose new value is it
+	FieldValue string
+	// ConditionType and ConditionStatus fire update when status of condition becomes ConditionStatus
+	ConditionType   string
+	ConditionStatus string
+	Payload         string
+}
+
+// K8sWatchTrigger watches any resource including custom resources with its own informer
+type K8sWatchTrigger struct {
+	Opts *K8sWatchOptions
+
+	EventChannel chan event.Event
+	startTime    time.Time
+	stopCh       chan struct{}
+}
+
+func parseK8sWatchMeta(meta map[string]string, namespace string) (opts *K8sWatchOptions, err error) {
+	opts = &K8sWatchOptions{
+		GVR: schema.GroupVersionResource{
+			Group:    meta["group"],
+			Version:  meta["version"],
+			Resource: meta["resource"],
+		},
+		Namespace:     meta["namespace"],
+		LabelSelector: meta["labelSelector"],
+		FieldSelector: meta["fieldSelector"],
+		FieldValue:    meta["fieldValue"],
+		Payload:       meta["payload"],
+	}
+	if opts.GVR.Version == "" || opts.GVR.Resource == "" {
+		return nil, errors.New("k8s watch trigger requires version and resource")
+	}
+	for _, gr := range deniedWatchResources {
+		if opts.GVR.GroupResource() == gr {
+			return nil, errors.New(fmt.Sprintf("k8s watch trigger cannot watch %s", gr.String()))
+		}
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = namespace
+	}
+	if opts.Namespace != namespace && !AllowCrossNamespaceWatch {
+		return nil, errors.New(fmt.Sprintf("k8s watch trigger of namespace %s cannot watch namespace %s", namespace, opts.Namespace))
+	}
+	if _, err = labels.Parse(opts.LabelSelector); err != nil {
+		return nil, errors.Wrapf(err, "not valid label selector %s", opts.LabelSelector)
+	}
+	if _, err = fields.ParseSelector(opts.FieldSelector); err != nil {
+		return nil, errors.Wrapf(err, "not valid field selector %s", opts.FieldSelector)
+	}
+	if events, ok := meta["events"]; ok {
+		for _, e := range strings.Split(events, ",") {
+			switch e {
+			case WatchAdd, WatchUpdate, WatchDelete:
+				opts.Events = append(opts.Events, e)
+			default:
+				return nil, errors.New(fmt.Sprintf("not valid watch event %s", e))
+			}
+		}
+	}
+	if paths, ok := meta["fieldPaths"]; ok {
+		for _, p := range strings.Split(paths, ",") {
+			jp := jsonpath.New("watch").AllowMissingKeys(true)
+			if err := jp.Parse(p); err != nil {
+				return nil, errors.Wrapf(err, "parse jsonpath %s", p)
+			}
+			opts.FieldPaths = append(opts.FieldPaths, jp)
+		}
+	}
+	if opts.FieldValue != "" && len(opts.FieldPaths) == 0 {
+		return nil, errors.New("fieldValue requires fieldPaths")
+	}
+	if condition, ok := meta["condition"]; ok {
+		kv := strings.SplitN(condition, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, errors.New(fmt.Sprintf("not valid condition %s, it should be like Ready=False", condition))
+		}
+		opts.ConditionType, opts.ConditionStatus = kv[0], kv[1]
+	}
+	switch opts.Payload {
+	case "":
+		opts.Payload = WatchObjectPayload
+	case WatchObjectPayload, WatchDiffPayload:
+	default:
+		return nil, errors.New(fmt.Sprintf("not support watch payload %s", opts.Payload))
+	}
+	return opts, nil
+}
+
+// NewK8sWatchTrigger watches resources in namespace of sensor unless cross namespace watch is allowed
+func NewK8sWatchTrigger(meta map[string]string, namespace string) (*K8sWatchTrigger, error) {
+	opts, err := parseK8sWatchMeta(meta, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse k8s watch meta")
+	}
+	return &K8sWatchTrigger{Opts: opts}, nil
+}
+
+func (m *K8sWatchTrigger) Run(ctx context.Context, eventChannel chan event.Event) error {
+	cfg, err := k8s.GetKubeConfig()
+	if err != nil {
+		return err
+	}
+	cli, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return errors.Wrap(err, "new dynamic client")
+	}
+	m.EventChannel = eventChannel
+	m.startTime = time.Now()
+	m.stopCh = make(chan struct{})
+
+	namespace := m.Opts.Namespace
+	if namespace == WatchAllNamespaces {
+		namespace = metav1.NamespaceAll
+	}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(cli, 0, namespace, func(o *metav1.ListOptions) {
+		o.LabelSelector = m.Opts.LabelSelector
+		o.FieldSelector = m.Opts.FieldSelector
+	})
+	informer := factory.ForResource(m.Opts.GVR).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			m.handle(WatchAdd, nil, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			m.handle(WatchUpdate, oldObj, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			m.handle(WatchDelete, nil, obj)
+		},
+	})
+	factory.Start(m.stopCh)
+	zap.L().Info(fmt.Sprintf("k8s watch trigger watches %s in namespace %q", m.Opts.GVR.String(), m.Opts.Namespace))
+	return nil
+}
+
+func (m *K8sWatchTrigger) Stop() error {
+	if m.stopCh != nil {
+		close(m.stopCh)
+		m.stopCh = nil
+	}
+	return nil
+}
+
+func (m *K8sWatchTrigger) handle(action string, oldObj, newObj interface{}) {
+	newU, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	oldU, _ := oldObj.(*unstructured.Unstructured)
+	// initial list replays existing objects as added
+	if action == WatchAdd && newU.GetCreationTimestamp().Time.Before(m.startTime.Truncate(time.Second)) {
+		return
+	}
+	e, ok, err := m.toEvent(action, oldU, newU)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("k8s watch of %s/%s: %v", newU.GetNamespace(), newU.GetName(), err))
+		return
+	}
+	if ok {
+		m.EventChannel <- e
+	}
+}
+
+// toEvent returns event of object change, false if change is filtered
+func (m *K8sWatchTrigger) toEvent(action string, oldObj, newObj *unstructured.Unstructured) (event.Event, bool, error) {
+	if len(m.Opts.Events) > 0 && !containsString(m.Opts.Events, action) {
+		return event.Event{}, false, nil
+	}
+	if action == WatchUpdate {
+		ok, err := m.updated(oldObj, newObj)
+		if err != nil || !ok {
+			return event.Event{}, false, err
+		}
+	}
+
+	we := WatchEvent{
+		Action:    action,
+		Name:      newObj.GetName(),
+		Namespace: newObj.GetNamespace(),
+	}
+	if m.Opts.Payload == WatchDiffPayload && action == WatchUpdate {
+		we.Diff = mergeDiff(oldObj.Object, newObj.Object)
+	} else {
+		we.Object = newObj.Object
+	}
+	data, err := json.Marshal(we)
+	if err != nil {
+		return event.Event{}, false, errors.Wrap(err, "marshal watch event")
+	}
+	e := event.NewEvent(newObj.GetNamespace(), string(v1.K8sWatchTriggerType), m.Opts.GVR.String(), "", string(data), "")
+	e.Key = fmt.Sprintf("%s/%s/%s", newObj.GetUID(), action, newObj.GetResourceVersion())
+	return e, true, nil
+}
+
+// updated reports whether update passes predicates of field paths and condition
+func (m *K8sWatchTrigger) updated(oldObj, newObj *unstructured.Unstructured) (bool, error) {
+	if oldObj == nil || oldObj.GetResourceVersion() == newObj.GetResourceVersion() {
+		// resync
+		return false, nil
+	}
+	if len(m.Opts.FieldPaths) > 0 {
+		changed := false
+		for _, jp := range m.Opts.FieldPaths {
+			oldValue, err := fieldValue(jp, oldObj.Object)
+			if err != nil {
+				return false, err
+			}
+			newValue, err := fieldValue(jp, newObj.Object)
+			if err != nil {
+				return false, err
+			}
+			if oldValue != newValue && (m.Opts.FieldValue == "" || newValue == m.Opts.FieldValue) {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return false, nil
+		}
+	}
+	if m.Opts.ConditionType != "" {
+		if conditionStatus(newObj, m.Opts.ConditionType) != m.Opts.ConditionStatus ||
+			conditionStatus(oldObj, m.Opts.ConditionType) == m.Opts.ConditionStatus {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func fieldValue(jp *jsonpath.JSONPath, obj map[string]interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := jp.Execute(buf, obj); err != nil {
+		return "", errors.Wrap(err, "exec jsonpath")
+	}
+	return buf.String(), nil
+}
+
+// conditionStatus returns status of condition in status.conditions, empty if there is no such condition
+func conditionStatus(obj *unstructured.Unstructured, conditionType string) string {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != conditionType {
+			continue
+		}
+		status, _ := condition["status"].(string)
+		return status
+	}
+	return ""
+}
+
+// mergeDiff returns json merge patch turning old into new
+func mergeDiff(oldObj, newObj map[string]interface{}) map[string]interface{} {
+	diff := map[string]interface{}{}
+	for k, v := range newObj {
+		ov, ok := oldObj[k]
+		if !ok {
+			diff[k] = v
+			continue
+		}
+		nm, nOk := v.(map[string]interface{})
+		om, oOk := ov.(map[string]interface{})
+		if nOk && oOk {
+			if d := mergeDiff(om, nm); len(d) > 0 {
+				diff[k] = d
+			}
+			continue
+		}
+		if !reflect.DeepEqual(ov, v) {
+			diff[k] = v
+		}
+	}
+	for k := range oldObj {
+		if _, ok := newObj[k]; !ok {
+			diff[k] = nil
+		}
+	}
+	return diff
+}
@@ -0,0 +1,144 @@
+package trigger
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+)
+
+func watchObject(rv string, replicas int64, ready string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":            "app",
+			"namespace":       "default",
+			"uid":             "u1",
+			"resourceVersion": rv,
+		},
+		"spec": map[string]interface{}{"replicas": replicas},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": ready},
+			},
+		},
+	}}
+}
+
+func TestParseK8sWatchMeta(t *testing.T) {
+	_, err := NewK8sWatchTrigger(map[string]string{"resource": "deployments"}, "app")
+	assert.NotNil(t, err)
+	_, err = NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "pods", "events": "patch"}, "app")
+	assert.NotNil(t, err)
+	_, err = NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "pods", "condition": "Ready"}, "app")
+	assert.NotNil(t, err)
+	_, err = NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "pods", "fieldValue": "1"}, "app")
+	assert.NotNil(t, err)
+	_, err = NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "pods", "labelSelector": "a in ("}, "app")
+	assert.NotNil(t, err)
+
+	m, err := NewK8sWatchTrigger(map[string]string{
+		"group":     "apps",
+		"version":   "v1",
+		"resource":  "deployments",
+		"condition": "Ready=False",
+	}, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "apps/v1, Resource=deployments", m.Opts.GVR.String())
+	assert.Equal(t, "Ready", m.Opts.ConditionType)
+	assert.Equal(t, "False", m.Opts.ConditionStatus)
+	assert.Equal(t, WatchObjectPayload, m.Opts.Payload)
+	assert.Equal(t, "app", m.Opts.Namespace)
+}
+
+func TestK8sWatchScope(t *testing.T) {
+	_, err := NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "secrets"}, "app")
+	assert.NotNil(t, err)
+	_, err = NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "pods", "namespace": "kube-system"}, "app")
+	assert.NotNil(t, err)
+	_, err = NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "nodes", "namespace": WatchAllNamespaces}, "app")
+	assert.NotNil(t, err)
+	m, err := NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "pods", "namespace": "app"}, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "app", m.Opts.Namespace)
+
+	AllowCrossNamespaceWatch = true
+	defer func() { AllowCrossNamespaceWatch = false }()
+	m, err = NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "nodes", "namespace": WatchAllNamespaces}, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, WatchAllNamespaces, m.Opts.Namespace)
+	_, err = NewK8sWatchTrigger(map[string]string{"version": "v1", "resource": "secrets", "namespace": WatchAllNamespaces}, "app")
+	assert.NotNil(t, err)
+}
+
+func TestK8sWatchPredicates(t *testing.T) {
+	m, err := NewK8sWatchTrigger(map[string]string{
+		"group":      "apps",
+		"version":    "v1",
+		"resource":   "deployments",
+		"events":     "update",
+		"fieldPaths": "{.spec.replicas}",
+	}, "app")
+	assert.Nil(t, err)
+
+	_, ok, err := m.toEvent(WatchAdd, nil, watchObject("1", 1, "True"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	// resync
+	_, ok, _ = m.toEvent(WatchUpdate, watchObject("1", 1, "True"), watchObject("1", 2, "True"))
+	assert.False(t, ok)
+	_, ok, _ = m.toEvent(WatchUpdate, watchObject("1", 1, "True"), watchObject("2", 1, "False"))
+	assert.False(t, ok)
+	e, ok, err := m.toEvent(WatchUpdate, watchObject("1", 1, "True"), watchObject("2", 2, "True"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "u1/update/2", e.Key)
+
+	m.Opts.FieldValue = "3"
+	_, ok, _ = m.toEvent(WatchUpdate, watchObject("1", 1, "True"), watchObject("2", 2, "True"))
+	assert.False(t, ok)
+	_, ok, _ = m.toEvent(WatchUpdate, watchObject("1", 1, "True"), watchObject("2", 3, "True"))
+	assert.True(t, ok)
+
+	m, err = NewK8sWatchTrigger(map[string]string{
+		"group":     "apps",
+		"version":   "v1",
+		"resource":  "deployments",
+		"condition": "Ready=False",
+	}, "app")
+	assert.Nil(t, err)
+	_, ok, _ = m.toEvent(WatchUpdate, watchObject("1", 1, "True"), watchObject("2", 1, "False"))
+	assert.True(t, ok)
+	_, ok, _ = m.toEvent(WatchUpdate, watchObject("2", 1, "False"), watchObject("3", 2, "False"))
+	assert.False(t, ok)
+	_, ok, _ = m.toEvent(WatchDelete, nil, watchObject("3", 2, "False"))
+	assert.True(t, ok)
+}
+
+func TestK8sWatchDiffPayload(t *testing.T) {
+	m, err := NewK8sWatchTrigger(map[string]string{
+		"group":    "apps",
+		"version":  "v1",
+		"resource": "deployments",
+		"payload":  "diff",
+	}, "app")
+	assert.Nil(t, err)
+
+	oldObj := watchObject("1", 1, "True")
+	newObj := watchObject("2", 2, "True")
+	unstructured.SetNestedField(oldObj.Object, "x", "metadata", "annotations", "a")
+	e, ok, err := m.toEvent(WatchUpdate, oldObj, newObj)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	var we WatchEvent
+	assert.Nil(t, json.Unmarshal([]byte(e.Data), &we))
+	assert.Equal(t, WatchUpdate, we.Action)
+	assert.Equal(t, "app", we.Name)
+	assert.Nil(t, we.Object)
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": "2", "annotations": nil},
+		"spec":     map[string]interface{}{"replicas": float64(2)},
+	}, we.Diff)
+}
@@ -9,8 +9,10 @@ import (
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type offsetResetPolicy string
@@ -20,6 +22,13 @@ const (
 	earliest offsetResetPolicy = "earliest"
 )
 
+type kafkaMode string
+
+const (
+	kafkaEventMode kafkaMode = "event" // every message is an event
+	kafkaScaleMode kafkaMode = "scale" // scale actor by consumer group lag, messages are consumed by actor
+)
+
 type kafkaSaslType string
 
 // supported SASL types
@@ -36,6 +45,7 @@ const (
 	defaultKafkaLagThreshold = 10
 	defaultOffsetResetPolicy = latest
 	invalidOffset            = -1
+	defaultPollingInterval   = 30
 )
 
 type KafkaOptions struct {
@@ -47,6 +57,9 @@ type KafkaOptions struct {
 	OffsetResetPolicy  offsetResetPolicy
 	AllowIdleConsumers bool
 	Version            sarama.KafkaVersion
+	Mode               kafkaMode
+	// PollingInterval is second between lag polling in scale mode
+	PollingInterval int
 
 	// SASL
 	SaslType kafkaSaslType
@@ -58,6 +71,11 @@ type KafkaMonitor struct {
 	Opts   *KafkaOptions
 	Config *sarama.Config
 	StopCh chan struct{}
+
+	// lag client in scale mode
+	clientMutex sync.Mutex
+	client      sarama.Client
+	admin       sarama.ClusterAdmin
 }
 
 func parseKafkaMeta(meta map[string]string) (opts *KafkaOptions, err error) {
@@ -88,11 +106,55 @@ func parseKafkaMeta(meta map[string]string) (opts *KafkaOptions, err error) {
 		delete(meta, "version")
 	}
 
+	opts.Mode = kafkaEventMode
+	if mode, ok := meta["mode"]; ok {
+		switch mode {
+		case string(kafkaEventMode), string(kafkaScaleMode):
+			opts.Mode = kafkaMode(mode)
+		default:
+			return nil, errors.New(fmt.Sprintf("not supported kafka mode %s", mode))
+		}
+		delete(meta, "mode")
+	}
+
+	opts.PollingInterval = defaultPollingInterval
+	if interval, ok := meta["pollingInterval"]; ok {
+		opts.PollingInterval, err = strconv.Atoi(interval)
+		if err != nil || opts.PollingInterval <= 0 {
+			return nil, errors.New(fmt.Sprintf("not valid pollingInterval %s", interval))
+		}
+		delete(meta, "pollingInterval")
+	}
+
+	if allowIdle, ok := meta["allowIdleConsumers"]; ok {
+		opts.AllowIdleConsumers, err = strconv.ParseBool(allowIdle)
+		if err != nil {
+			return nil, errors.Wrapf(err, "not valid allowIdleConsumers %s", allowIdle)
+		}
+		delete(meta, "allowIdleConsumers")
+	}
+
 	err = mapstructure.Decode(meta, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	if opts.OffsetResetPolicy == "" {
+		opts.OffsetResetPolicy = defaultOffsetResetPolicy
+	}
+	if opts.ConsumerGroup == "" {
+		opts.ConsumerGroup = opts.Group
+	}
+	if opts.Mode == kafkaScaleMode && opts.ConsumerGroup == "" {
+		return nil, errors.New("consumerGroup is required in kafka scale mode")
+	}
+	if opts.LagThreshold != "" {
+		threshold, err := strconv.Atoi(opts.LagThreshold)
+		if err != nil || threshold <= 0 {
+			return nil, errors.New(fmt.Sprintf("not valid %s %s", lagThresholdMetricName, opts.LagThreshold))
+		}
+	}
+
 	return opts, nil
 }
 
@@ -148,6 +210,7 @@ func NewKafkaMonitor(meta map[string]string) (*KafkaMonitor, error) {
 	m := &KafkaMonitor{
 		Opts:   opts,
 		Config: cfg,
+		StopCh: make(chan struct{}, 1),
 	}
 
 	return m, nil
@@ -202,6 +265,10 @@ func (m *KafkaMonitor) getTopicOffsets(client sarama.Client, partitions []int32)
 }
 
 func (m *KafkaMonitor) Run(ctx context.Context, eventChannel chan event.Event) error {
+	if m.Opts.Mode == kafkaScaleMode {
+		zap.L().Info(fmt.Sprintf("kafka trigger of topic %s group %s runs in scale mode", m.Opts.Topic, m.Opts.ConsumerGroup))
+		return nil
+	}
 	consumer, err := sarama.NewConsumer(m.Opts.Servers, m.Config)
 	if err != nil {
 		return errors.Wrap(err, "new consumer")
@@ -236,7 +303,9 @@ func (m *KafkaMonitor) Run(ctx context.Context, eventChannel chan event.Event) e
 			for {
 				select {
 				case message := <-pc.Messages():
-					eventChannel <- event.NewSimpleEvent(string(v1.KafkaTriggerType), message.Topic, string(message.Value))
+					ev := event.NewSimpleEvent(string(v1.KafkaTriggerType), message.Topic, string(message.Value))
+					ev.Key = string(message.Key)
+					eventChannel <- ev
 				}
 			}
 		}(pc)
@@ -253,6 +322,124 @@ func (m *KafkaMonitor) Run(ctx context.Context, eventChannel chan event.Event) e
 }
 
 func (m *KafkaMonitor) Stop() error {
+	m.clientMutex.Lock()
+	if m.admin != nil {
+		m.admin.Close()
+		m.admin = nil
+		m.client = nil
+	}
+	m.clientMutex.Unlock()
+	if m.Opts.Mode == kafkaScaleMode {
+		return nil
+	}
 	m.StopCh <- struct{}{}
 	return nil
 }
+
+func (m *KafkaMonitor) MetricEnabled() bool {
+	return m.Opts.Mode == kafkaScaleMode
+}
+
+func (m *KafkaMonitor) PollingInterval() time.Duration {
+	return time.Duration(m.Opts.PollingInterval) * time.Second
+}
+
+// GetMetric returns total lag of consumer group on topic, lagThreshold is the lag one replica handles
+func (m *KafkaMonitor) GetMetric(ctx context.Context) (*ScaleMetric, error) {
+	client, admin, err := m.getAdmin()
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := client.Partitions(m.Opts.Topic)
+	if err != nil {
+		m.resetAdmin()
+		return nil, errors.Wrapf(err, "get partitions of topic %s", m.Opts.Topic)
+	}
+	lag, err := m.getLag(client, admin, partitions)
+	if err != nil {
+		m.resetAdmin()
+		return nil, err
+	}
+
+	threshold := int64(defaultKafkaLagThreshold)
+	if m.Opts.LagThreshold != "" {
+		t, _ := strconv.Atoi(m.Opts.LagThreshold)
+		threshold = int64(t)
+	}
+	metric := &ScaleMetric{Value: lag, Target: threshold}
+	if !m.Opts.AllowIdleConsumers {
+		// consumers more than partitions are idle
+		metric.MaxReplicas = int32(len(partitions))
+	}
+	zap.L().Debug(fmt.Sprintf("kafka topic %s group %s lag %d, threshold %d", m.Opts.Topic, m.Opts.ConsumerGroup, lag, threshold))
+	return metric, nil
+}
+
+func (m *KafkaMonitor) getLag(client sarama.Client, admin sarama.ClusterAdmin, partitions []int32) (int64, error) {
+	groupOffsets, err := admin.ListConsumerGroupOffsets(m.Opts.ConsumerGroup, map[string][]int32{m.Opts.Topic: partitions})
+	if err != nil {
+		return 0, errors.Wrapf(err, "list offsets of consumer group %s", m.Opts.ConsumerGroup)
+	}
+	topicOffsets, err := m.getTopicOffsets(client, partitions)
+	if err != nil {
+		return 0, errors.Wrapf(err, "get offsets of topic %s", m.Opts.Topic)
+	}
+
+	var total int64
+	for _, partition := range partitions {
+		latest, ok := topicOffsets[partition]
+		if !ok {
+			continue
+		}
+		consumed := int64(invalidOffset)
+		if block := groupOffsets.GetBlock(m.Opts.Topic, partition); block != nil {
+			if block.Err != sarama.ErrNoError {
+				return 0, errors.Wrapf(block.Err, "offset of partition %d", partition)
+			}
+			consumed = block.Offset
+		}
+		if consumed == invalidOffset {
+			// group has not committed yet, it starts from reset policy
+			if m.Opts.OffsetResetPolicy == earliest {
+				total += latest
+			}
+			continue
+		}
+		if latest > consumed {
+			total += latest - consumed
+		}
+	}
+	return total, nil
+}
+
+func (m *KafkaMonitor) getAdmin() (sarama.Client, sarama.ClusterAdmin, error) {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+	if m.admin != nil {
+		return m.client, m.admin, nil
+	}
+	client, err := sarama.NewClient(m.Opts.Servers, m.Config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating kafka client: %s", err)
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		if !client.Closed() {
+			client.Close()
+		}
+		return nil, nil, fmt.Errorf("error creating kafka admin: %s", err)
+	}
+	m.client, m.admin = client, admin
+	return client, admin, nil
+}
+
+// resetAdmin closes client after failure, it is recreated by next polling
+func (m *KafkaMonitor) resetAdmin() {
+	m.clientMutex.Lock()
+	defer m.clientMutex.Unlock()
+	if m.admin != nil {
+		m.admin.Close()
+	}
+	m.admin = nil
+	m.client = nil
+}
@@ -31,3 +31,30 @@ func TestParseKafkaMeta(t *testing.T) {
 	assert.Equal(t, kafkaOpts.Servers, opt.Servers)
 	assert.Equal(t, kafkaOpts.OffsetResetPolicy, opt.OffsetResetPolicy)
 }
+
+func TestParseKafkaScaleMeta(t *testing.T) {
+	meta := map[string]string{
+		"topic":              "topic",
+		"servers":            "a",
+		"mode":               "scale",
+		"consumerGroup":      "group",
+		"lagThreshold":       "20",
+		"pollingInterval":    "5",
+		"allowIdleConsumers": "true",
+	}
+
+	opt, err := parseKafkaMeta(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, kafkaScaleMode, opt.Mode)
+	assert.Equal(t, "group", opt.ConsumerGroup)
+	assert.Equal(t, "20", opt.LagThreshold)
+	assert.Equal(t, 5, opt.PollingInterval)
+	assert.True(t, opt.AllowIdleConsumers)
+	assert.Equal(t, latest, opt.OffsetResetPolicy)
+
+	_, err = parseKafkaMeta(map[string]string{"topic": "topic", "mode": "scale"})
+	assert.Error(t, err)
+}
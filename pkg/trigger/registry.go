@@ -0,0 +1,333 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"eventrigger.com/operator/common/consts"
+	"eventrigger.com/operator/common/event"
+	"eventrigger.com/operator/common/server"
+	v1 "eventrigger.com/operator/pkg/api/core/v1"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+type registryFormat string
+
+// grammar of image reference of docker/distribution/reference
+var (
+	referenceDomain     = regexp.MustCompile(`^(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?$`)
+	referenceRepository = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*$`)
+	referenceTag        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	referenceDigest     = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[[:xdigit:]]{32,}$`)
+)
+
+const (
+	// DistributionRegistry is notification of docker distribution registry, events are batched in envelope
+	DistributionRegistry registryFormat = "distribution"
+	HarborRegistry       registryFormat = "harbor"
+	// OCIRegistry is a single event of distribution schema, which is sent by other oci registries like acr
+	OCIRegistry registryFormat = "oci"
+
+	harborPushArtifact = "PUSH_ARTIFACT"
+)
+
+// RegistryEvent is image push normalized, it is data of event. Image and ImageDigest can be set to
+// image of containers by templates of k8s actor, e.g. {{ .Data.image | quote }}
+type RegistryEvent struct {
+	Registry    string `json:"registry"`
+	Repository  string `json:"repository"`
+	Tag         string `json:"tag"`
+	Digest      string `json:"digest"`
+	Pusher      string `json:"pusher"`
+	Image       string `json:"image"`
+	ImageDigest string `json:"image_digest,omitempty"`
+}
+
+type RegistryOptions struct {
+	Hosts []string
+	Paths []string
+	// Format of payload, detected by payload if empty
+	Format registryFormat
+	// Repositories are glob patterns of repository like library/*
+	Repositories []string
+	// Tags is regexp tag must match
+	Tags *regexp.Regexp
+	Auth AuthOptions
+}
+
+type RegistryTrigger struct {
+	Opts *RegistryOptions
+	// Auth authenticates registries, e.g. by Authorization header of distribution notification endpoint
+	Auth *authenticator
+
+	EventChannel chan event.Event
+}
+
+func parseRegistryMeta(meta map[string]string) (opts *RegistryOptions, err error) {
+	opts = &RegistryOptions{
+		Format: registryFormat(meta["format"]),
+	}
+	switch opts.Format {
+	case "", DistributionRegistry, HarborRegistry, OCIRegistry:
+	default:
+		return nil, errors.New(fmt.Sprintf("not support registry format %s", opts.Format))
+	}
+	if hosts, ok := meta["hosts"]; ok {
+		opts.Hosts = strings.Split(hosts, ",")
+	}
+	if paths, ok := meta["paths"]; ok {
+		opts.Paths = strings.Split(paths, ",")
+	}
+	if len(opts.Hosts) == 0 && len(opts.Paths) == 0 {
+		return nil, errors.New("registry trigger requires hosts or paths")
+	}
+	if repositories, ok := meta["repositories"]; ok {
+		opts.Repositories = strings.Split(repositories, ",")
+		for _, r := range opts.Repositories {
+			if _, err := path.Match(r, ""); err != nil {
+				return nil, errors.New(fmt.Sprintf("not valid repository pattern %s", r))
+			}
+		}
+	}
+	if tags, ok := meta["tags"]; ok {
+		opts.Tags, err = regexp.Compile(tags)
+		if err != nil {
+			return nil, errors.Wrapf(err, "not valid tags regexp %s", tags)
+		}
+	}
+	opts.Auth, err = parseAuthMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func NewRegistryTrigger(meta map[string]string, namespace string) (*RegistryTrigger, error) {
+	opts, err := parseRegistryMeta(meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse registry meta")
+	}
+	return &RegistryTrigger{
+		Opts: opts,
+		Auth: newAuthenticator(opts.Auth, namespace),
+	}, nil
+}
+
+func (m *RegistryTrigger) Handler(c *gin.Context) (int, interface{}, error) {
+	if err := m.Auth.Authenticate(c.Request); err != nil {
+		c.Header("WWW-Authenticate", m.Auth.Challenge())
+		return http.StatusUnauthorized, nil, err
+	}
+	rawData, err := c.GetRawData()
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	pushes, err := parseRegistryEvents(m.Opts.Format, rawData)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	uuid := c.Request.Header.Get(consts.UUIDLabelHeader)
+	var sent []event.Event
+	for _, push := range pushes {
+		if !m.match(push) {
+			zap.L().Debug(fmt.Sprintf("registry push of %s is filtered", push.Image))
+			continue
+		}
+		data, err := json.Marshal(push)
+		if err != nil {
+			return 0, nil, err
+		}
+		// uuid of request identifies only one event, the others get their own
+		sEvent := event.NewEvent("", string(v1.RegistryTriggerType), push.Repository, "", string(data), uuid)
+		uuid = ""
+		m.EventChannel <- sEvent
+		sent = append(sent, sEvent)
+	}
+	return 0, sent, nil
+}
+
+func (m *RegistryTrigger) match(push RegistryEvent) bool {
+	if len(m.Opts.Repositories) > 0 && !matchAny(m.Opts.Repositories, push.Repository) {
+		return false
+	}
+	if m.Opts.Tags != nil && !m.Opts.Tags.MatchString(push.Tag) {
+		return false
+	}
+	return true
+}
+
+type distributionEvent struct {
+	Action string `json:"action"`
+	Target struct {
+		MediaType  string `json:"mediaType"`
+		Digest     string `json:"digest"`
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+	} `json:"target"`
+	Request struct {
+		Host string `json:"host"`
+	} `json:"request"`
+	Actor struct {
+		Name string `json:"name"`
+	} `json:"actor"`
+}
+
+type harborEvent struct {
+	Type      string `json:"type"`
+	Operator  string `json:"operator"`
+	EventData struct {
+		Resources []struct {
+			Digest      string `json:"digest"`
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+		Repository struct {
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+}
+
+// parseRegistryEvents returns pushes of tagged manifests in payload, other events like pull are skipped
+func parseRegistryEvents(format registryFormat, body []byte) ([]RegistryEvent, error) {
+	if format == "" {
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(body, &probe); err != nil {
+			return nil, errors.Wrap(err, "decode registry payload")
+		}
+		switch {
+		case probe["events"] != nil:
+			format = DistributionRegistry
+		case probe["event_data"] != nil:
+			format = HarborRegistry
+		case probe["target"] != nil:
+			format = OCIRegistry
+		default:
+			return nil, errors.New("unknown registry payload")
+		}
+	}
+
+	var pushes []RegistryEvent
+	switch format {
+	case DistributionRegistry:
+		var envelope struct {
+			Events []distributionEvent `json:"events"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return nil, errors.Wrap(err, "decode distribution notification")
+		}
+		for _, e := range envelope.Events {
+			if push, ok := e.push(); ok {
+				pushes = append(pushes, push)
+			}
+		}
+	case OCIRegistry:
+		var e distributionEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			return nil, errors.Wrap(err, "decode oci push event")
+		}
+		if push, ok := e.push(); ok {
+			pushes = append(pushes, push)
+		}
+	case HarborRegistry:
+		var e harborEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			return nil, errors.Wrap(err, "decode harbor webhook")
+		}
+		if e.Type != harborPushArtifact {
+			return nil, nil
+		}
+		for _, r := range e.EventData.Resources {
+			// artifacts pushed by digest only are skipped like manifests of distribution
+			if r.Tag == "" {
+				continue
+			}
+			registry := strings.SplitN(r.ResourceURL, "/", 2)[0]
+			pushes = append(pushes, newRegistryEvent(registry, e.EventData.Repository.RepoFullName, r.Tag, r.Digest, e.Operator))
+		}
+	}
+	// images are rendered into resources, so a payload of invalid reference is rejected as a whole
+	for _, push := range pushes {
+		if err := push.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return pushes, nil
+}
+
+// validate checks registry, repository, tag and digest against grammar of image reference
+func (e RegistryEvent) validate() error {
+	if e.Registry != "" && !referenceDomain.MatchString(e.Registry) {
+		return errors.New(fmt.Sprintf("not valid registry %q", e.Registry))
+	}
+	if len(e.Repository) > 255 || !referenceRepository.MatchString(e.Repository) {
+		return errors.New(fmt.Sprintf("not valid repository %q", e.Repository))
+	}
+	if !referenceTag.MatchString(e.Tag) {
+		return errors.New(fmt.Sprintf("not valid tag %q", e.Tag))
+	}
+	if e.Digest != "" && !referenceDigest.MatchString(e.Digest) {
+		return errors.New(fmt.Sprintf("not valid digest %q", e.Digest))
+	}
+	return nil
+}
+
+// push is tagged manifest pushed, blobs and manifests pushed by digest only are skipped
+func (e distributionEvent) push() (RegistryEvent, bool) {
+	if e.Action != "push" || e.Target.Tag == "" || strings.Contains(e.Target.MediaType, "layer") {
+		return RegistryEvent{}, false
+	}
+	return newRegistryEvent(e.Request.Host, e.Target.Repository, e.Target.Tag, e.Target.Digest, e.Actor.Name), true
+}
+
+func newRegistryEvent(registry, repository, tag, digest, pusher string) RegistryEvent {
+	image := repository
+	if registry != "" {
+		image = registry + "/" + repository
+	}
+	e := RegistryEvent{
+		Registry:   registry,
+		Repository: repository,
+		Tag:        tag,
+		Digest:     digest,
+		Pusher:     pusher,
+		Image:      image + ":" + tag,
+	}
+	if digest != "" {
+		e.ImageDigest = image + "@" + digest
+	}
+	return e
+}
+
+func (m *RegistryTrigger) Run(ctx context.Context, eventChannel chan event.Event) error {
+	m.EventChannel = eventChannel
+	for _, host := range m.Opts.Hosts {
+		zap.L().Info(fmt.Sprintf("registry trigger add host: %s", host))
+		if err := server.GlobalHttpServer.AddOrReplaceHostMap(host, m.Handler); err != nil {
+			return errors.Wrapf(err, "add host %s", host)
+		}
+	}
+	for _, prefix := range m.Opts.Paths {
+		zap.L().Info(fmt.Sprintf("registry trigger add path prefix: %s", prefix))
+		if err := server.GlobalHttpServer.AddOrReplacePathPrefixMap(prefix, m.Handler); err != nil {
+			return errors.Wrapf(err, "add path prefix %s", prefix)
+		}
+	}
+	return nil
+}
+
+func (m *RegistryTrigger) Stop() error {
+	for _, host := range m.Opts.Hosts {
+		server.GlobalHttpServer.DeleteHostMap(host)
+	}
+	for _, prefix := range m.Opts.Paths {
+		server.GlobalHttpServer.DeletePathPrefixMap(prefix)
+	}
+	return nil
+}
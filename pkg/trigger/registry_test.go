@@ -0,0 +1,77 @@
+package trigger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseRegistryEvents(t *testing.T) {
+	distribution := `{"events":[
+		{"action":"push","target":{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","digest":"sha256:1111111111111111111111111111111111111111111111111111111111111111","repository":"library/web","tag":"v1"},"request":{"host":"r.io"},"actor":{"name":"ci"}},
+		{"action":"push","target":{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","digest":"sha256:2222222222222222222222222222222222222222222222222222222222222222","repository":"library/web"},"request":{"host":"r.io"}},
+		{"action":"pull","target":{"repository":"library/web","tag":"v1"},"request":{"host":"r.io"}}]}`
+	pushes, err := parseRegistryEvents("", []byte(distribution))
+	assert.Nil(t, err)
+	assert.Equal(t, []RegistryEvent{{
+		Registry:    "r.io",
+		Repository:  "library/web",
+		Tag:         "v1",
+		Digest:      "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		Pusher:      "ci",
+		Image:       "r.io/library/web:v1",
+		ImageDigest: "r.io/library/web@sha256:1111111111111111111111111111111111111111111111111111111111111111",
+	}}, pushes)
+
+	harbor := `{"type":"PUSH_ARTIFACT","operator":"admin","event_data":{"resources":[{"digest":"sha256:3333333333333333333333333333333333333333333333333333333333333333","tag":"latest",
+		"resource_url":"harbor.io/library/nginx:latest"}],"repository":{"repo_full_name":"library/nginx"}}}`
+	pushes, err = parseRegistryEvents("", []byte(harbor))
+	assert.Nil(t, err)
+	assert.Len(t, pushes, 1)
+	assert.Equal(t, "harbor.io/library/nginx:latest", pushes[0].Image)
+	assert.Equal(t, "admin", pushes[0].Pusher)
+
+	// artifact pushed by digest only is skipped
+	byDigest := `{"type":"PUSH_ARTIFACT","operator":"admin","event_data":{"resources":[{"digest":"sha256:3333333333333333333333333333333333333333333333333333333333333333",
+		"resource_url":"harbor.io/library/nginx@sha256:3333333333333333333333333333333333333333333333333333333333333333"}],"repository":{"repo_full_name":"library/nginx"}}}`
+	pushes, err = parseRegistryEvents(HarborRegistry, []byte(byDigest))
+	assert.Nil(t, err)
+	assert.Empty(t, pushes)
+
+	pushes, err = parseRegistryEvents(HarborRegistry, []byte(`{"type":"DELETE_ARTIFACT"}`))
+	assert.Nil(t, err)
+	assert.Empty(t, pushes)
+
+	oci := `{"action":"push","target":{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:4444444444444444444444444444444444444444444444444444444444444444","repository":"app","tag":"1.2.0"},"request":{"host":"a.azurecr.io"}}`
+	pushes, err = parseRegistryEvents("", []byte(oci))
+	assert.Nil(t, err)
+	assert.Equal(t, "a.azurecr.io/app:1.2.0", pushes[0].Image)
+
+	_, err = parseRegistryEvents("", []byte(`{"foo":1}`))
+	assert.NotNil(t, err)
+
+	// host of request is rendered into resources, it must be a registry domain
+	malicious := `{"action":"push","target":{"repository":"app","tag":"v1"},"request":{"host":"r.io\"\n      command: [\"sh\"]"}}`
+	_, err = parseRegistryEvents("", []byte(malicious))
+	assert.NotNil(t, err)
+	_, err = parseRegistryEvents("", []byte(`{"action":"push","target":{"repository":"App","tag":"v1"},"request":{"host":"r.io"}}`))
+	assert.NotNil(t, err)
+	_, err = parseRegistryEvents("", []byte(`{"action":"push","target":{"repository":"app","tag":"v1 --x"},"request":{"host":"r.io"}}`))
+	assert.NotNil(t, err)
+}
+
+func TestRegistryTriggerMatch(t *testing.T) {
+	_, err := NewRegistryTrigger(map[string]string{"paths": "/registry", "tags": "("}, "app")
+	assert.NotNil(t, err)
+	_, err = NewRegistryTrigger(map[string]string{"paths": "/registry", "format": "quay"}, "app")
+	assert.NotNil(t, err)
+
+	m, err := NewRegistryTrigger(map[string]string{
+		"paths":        "/registry",
+		"repositories": "library/*",
+		"tags":         `^v\d+\.\d+\.\d+$`,
+	}, "app")
+	assert.Nil(t, err)
+	assert.True(t, m.match(RegistryEvent{Repository: "library/web", Tag: "v1.0.0"}))
+	assert.False(t, m.match(RegistryEvent{Repository: "library/web", Tag: "latest"}))
+	assert.False(t, m.match(RegistryEvent{Repository: "team/web", Tag: "v1.0.0"}))
+}
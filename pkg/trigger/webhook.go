@@ -0,0 +1,282 @@
+package trigger
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"eventrigger.com/operator/common/server"
+	"fmt"
+	"github.com/pkg/errors"
+	"hash"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type webhookProvider string
+
+const (
+	GithubWebhook    webhookProvider = "github"
+	GitlabWebhook    webhookProvider = "gitlab"
+	GiteaWebhook     webhookProvider = "gitea"
+	BitbucketWebhook webhookProvider = "bitbucket"
+	// HmacWebhook verifies hmac of body, or of timestamp and body joined by dot if timestamp header is set
+	HmacWebhook webhookProvider = "hmac"
+
+	defaultWebhookSecretKey   = "secret"
+	defaultSignatureHeader    = "X-Signature"
+	defaultTimestampTolerance = 300
+
+	// maxWebhookDeliveries is how many deliveries a verifier remembers, the oldest are forgotten first
+	maxWebhookDeliveries = 10000
+)
+
+// WebhookOptions verifies signatures of webhooks with secret, Secret is name of secret in namespace of sensor
+type WebhookOptions struct {
+	Provider  webhookProvider
+	Secret    string
+	SecretKey string
+	// generic hmac signature, e.g. header X-Signature with value sha256=<hex>
+	SignatureHeader    string
+	SignatureAlgorithm string
+	SignaturePrefix    string
+	SignatureEncoding  string
+	TimestampHeader    string
+	// ReplayProtection drops deliveries whose signature is seen within tolerance, generic hmac requires
+	// TimestampHeader for it, so that captured deliveries cannot be replayed after tolerance either
+	ReplayProtection bool
+	// AllowSha1Signature accepts sha1 X-Hub-Signature of github, only for servers which cannot send sha256
+	AllowSha1Signature bool
+	// TimestampTolerance is second timestamp may differ from now, and deliveries are remembered
+	TimestampTolerance int
+}
+
+func parseWebhookMeta(meta map[string]string) (opts WebhookOptions, err error) {
+	opts = WebhookOptions{
+		Provider:           webhookProvider(meta["webhook"]),
+		Secret:             meta["webhookSecret"],
+		SecretKey:          meta["webhookSecretKey"],
+		SignatureHeader:    meta["signatureHeader"],
+		SignatureAlgorithm: meta["signatureAlgorithm"],
+		SignaturePrefix:    meta["signaturePrefix"],
+		SignatureEncoding:  meta["signatureEncoding"],
+		TimestampHeader:    meta["timestampHeader"],
+		ReplayProtection:   true,
+		TimestampTolerance: defaultTimestampTolerance,
+	}
+	if opts.Provider == "" {
+		return opts, nil
+	}
+	if replay, ok := meta["replayProtection"]; ok {
+		opts.ReplayProtection, err = strconv.ParseBool(replay)
+		if err != nil {
+			return opts, errors.New(fmt.Sprintf("not valid replayProtection %s", replay))
+		}
+	}
+	switch opts.Provider {
+	case GithubWebhook, GitlabWebhook, GiteaWebhook, BitbucketWebhook:
+	case HmacWebhook:
+		if opts.SignatureHeader == "" {
+			opts.SignatureHeader = defaultSignatureHeader
+		}
+		if opts.SignatureAlgorithm == "" {
+			opts.SignatureAlgorithm = "sha256"
+		}
+		if _, err = hashOf(opts.SignatureAlgorithm); err != nil {
+			return opts, err
+		}
+		switch opts.SignatureEncoding {
+		case "":
+			opts.SignatureEncoding = "hex"
+		case "hex", "base64":
+		default:
+			return opts, errors.New(fmt.Sprintf("not valid signatureEncoding %s", opts.SignatureEncoding))
+		}
+		if opts.ReplayProtection && opts.TimestampHeader == "" {
+			return opts, errors.New("hmac webhook requires timestampHeader for replay protection, or replayProtection false")
+		}
+	default:
+		return opts, errors.New(fmt.Sprintf("not support webhook %s", opts.Provider))
+	}
+	if opts.Secret == "" {
+		return opts, errors.New(fmt.Sprintf("webhook %s requires webhookSecret", opts.Provider))
+	}
+	if err := validSecretName("webhookSecret", opts.Secret); err != nil {
+		return opts, err
+	}
+	if opts.SecretKey == "" {
+		opts.SecretKey = defaultWebhookSecretKey
+	}
+	if allow, ok := meta["allowSha1Signature"]; ok {
+		if opts.Provider != GithubWebhook {
+			return opts, errors.New("allowSha1Signature is only for github webhook")
+		}
+		opts.AllowSha1Signature, err = strconv.ParseBool(allow)
+		if err != nil {
+			return opts, errors.New(fmt.Sprintf("not valid allowSha1Signature %s", allow))
+		}
+	}
+	if tolerance, ok := meta["timestampTolerance"]; ok {
+		opts.TimestampTolerance, err = strconv.Atoi(tolerance)
+		if err != nil || opts.TimestampTolerance <= 0 {
+			return opts, errors.New(fmt.Sprintf("not valid timestampTolerance %s", tolerance))
+		}
+	}
+	return opts, nil
+}
+
+func hashOf(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "sha1":
+		return sha1.New, nil
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, errors.New(fmt.Sprintf("not support signatureAlgorithm %s", algorithm))
+}
+
+// webhookVerifier verifies signature of webhook and drops replayed deliveries
+type webhookVerifier struct {
+	Opts      WebhookOptions
+	Namespace string
+
+	secrets secretGetter
+	mutex   sync.Mutex
+	// signatures of deliveries expire after tolerance
+	deliveries *cache.LRUExpireCache
+}
+
+// newWebhookVerifier returns nil if webhook is not set, secret is read from namespace
+func newWebhookVerifier(opts WebhookOptions, namespace string) *webhookVerifier {
+	if opts.Provider == "" {
+		return nil
+	}
+	return &webhookVerifier{
+		Opts:       opts,
+		Namespace:  namespace,
+		secrets:    server.GlobalSecretCache.Get,
+		deliveries: cache.NewLRUExpireCache(maxWebhookDeliveries),
+	}
+}
+
+// Verify returns error if signature of body is not valid or delivery is replayed, nil verifier passes all requests
+func (v *webhookVerifier) Verify(req *http.Request, body []byte) error {
+	if v == nil {
+		return nil
+	}
+	s, err := v.secrets(v.Namespace, v.Opts.Secret)
+	if err != nil {
+		return err
+	}
+	secret, ok := s.Data[v.Opts.SecretKey]
+	if !ok || len(secret) == 0 {
+		return errors.New(fmt.Sprintf("no %s in webhook secret %s", v.Opts.SecretKey, v.Opts.Secret))
+	}
+
+	// signature is what replays are recognized by, since delivery ids are not signed
+	var sig string
+	switch v.Opts.Provider {
+	case GithubWebhook:
+		if sig = req.Header.Get("X-Hub-Signature-256"); sig != "" || !v.Opts.AllowSha1Signature {
+			err = verifyHmac(sha256.New, secret, body, strings.TrimPrefix(sig, "sha256="), "hex")
+		} else {
+			sig = req.Header.Get("X-Hub-Signature")
+			err = verifyHmac(sha1.New, secret, body, strings.TrimPrefix(sig, "sha1="), "hex")
+		}
+	case GitlabWebhook:
+		// gitlab sends the secret token itself instead of signature, so body is what identifies delivery
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("X-Gitlab-Token")), secret) != 1 {
+			err = errors.New("gitlab token is not valid")
+		}
+		digest := sha256.Sum256(body)
+		sig = hex.EncodeToString(digest[:])
+	case GiteaWebhook:
+		sig = req.Header.Get("X-Gitea-Signature")
+		err = verifyHmac(sha256.New, secret, body, sig, "hex")
+	case BitbucketWebhook:
+		sig = req.Header.Get("X-Hub-Signature")
+		err = verifyHmac(sha256.New, secret, body, strings.TrimPrefix(sig, "sha256="), "hex")
+	case HmacWebhook:
+		sig, err = v.verifyGeneric(req, secret, body)
+	}
+	if err != nil {
+		return err
+	}
+	if !v.Opts.ReplayProtection {
+		return nil
+	}
+	return v.checkReplay(sig)
+}
+
+// verifyGeneric returns verified signature, timestamp is signed with body if it is set
+func (v *webhookVerifier) verifyGeneric(req *http.Request, secret, body []byte) (string, error) {
+	payload := body
+	if v.Opts.TimestampHeader != "" {
+		ts := req.Header.Get(v.Opts.TimestampHeader)
+		if err := v.checkTimestamp(ts, time.Now()); err != nil {
+			return "", err
+		}
+		payload = append([]byte(ts+"."), body...)
+	}
+	h, _ := hashOf(v.Opts.SignatureAlgorithm)
+	sig := strings.TrimPrefix(req.Header.Get(v.Opts.SignatureHeader), v.Opts.SignaturePrefix)
+	return sig, verifyHmac(h, secret, payload, sig, v.Opts.SignatureEncoding)
+}
+
+// checkTimestamp rejects timestamp of unix seconds out of tolerance
+func (v *webhookVerifier) checkTimestamp(ts string, now time.Time) error {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New(fmt.Sprintf("not valid timestamp %q in header %s", ts, v.Opts.TimestampHeader))
+	}
+	diff := now.Sub(time.Unix(sec, 0))
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > time.Duration(v.Opts.TimestampTolerance)*time.Second {
+		return errors.New(fmt.Sprintf("timestamp %s is out of tolerance %ds", ts, v.Opts.TimestampTolerance))
+	}
+	return nil
+}
+
+// checkReplay rejects delivery whose verified signature is seen within tolerance
+func (v *webhookVerifier) checkReplay(signature string) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if _, ok := v.deliveries.Get(signature); ok {
+		return errors.New(fmt.Sprintf("delivery of signature %s is replayed", signature))
+	}
+	v.deliveries.Add(signature, struct{}{}, time.Duration(v.Opts.TimestampTolerance)*time.Second)
+	return nil
+}
+
+func verifyHmac(h func() hash.Hash, secret, payload []byte, signature, encoding string) error {
+	if signature == "" {
+		return errors.New("no webhook signature")
+	}
+	var expected []byte
+	var err error
+	if encoding == "base64" {
+		expected, err = base64.StdEncoding.DecodeString(signature)
+	} else {
+		expected, err = hex.DecodeString(signature)
+	}
+	if err != nil {
+		return errors.New("not valid webhook signature encoding")
+	}
+	mac := hmac.New(h, secret)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.New("webhook signature is not valid")
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package trigger
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func sign256(secret, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func newTestVerifier(t *testing.T, meta map[string]string) *webhookVerifier {
+	opts, err := parseWebhookMeta(meta)
+	assert.Nil(t, err)
+	v := newWebhookVerifier(opts, "app")
+	v.secrets = fakeSecrets(map[string]*v1.Secret{"app/hook": {Data: map[string][]byte{"secret": []byte("s3cret")}}})
+	return v
+}
+
+func TestParseWebhookMeta(t *testing.T) {
+	opts, err := parseWebhookMeta(map[string]string{})
+	assert.Nil(t, err)
+	assert.Nil(t, newWebhookVerifier(opts, "app"))
+
+	_, err = parseWebhookMeta(map[string]string{"webhook": "github"})
+	assert.NotNil(t, err)
+	_, err = parseWebhookMeta(map[string]string{"webhook": "svn", "webhookSecret": "hook"})
+	assert.NotNil(t, err)
+	_, err = parseWebhookMeta(map[string]string{"webhook": "hmac", "webhookSecret": "hook", "signatureAlgorithm": "md5"})
+	assert.NotNil(t, err)
+	_, err = parseWebhookMeta(map[string]string{"webhook": "github", "webhookSecret": "kube-system/hook"})
+	assert.NotNil(t, err)
+
+	opts, err = parseWebhookMeta(map[string]string{"webhook": "github", "webhookSecret": "hook"})
+	assert.Nil(t, err)
+	assert.True(t, opts.ReplayProtection)
+	assert.Equal(t, defaultWebhookSecretKey, opts.SecretKey)
+
+	// generic hmac cannot tell replays after tolerance without signed timestamp
+	_, err = parseWebhookMeta(map[string]string{"webhook": "hmac", "webhookSecret": "hook"})
+	assert.NotNil(t, err)
+	opts, err = parseWebhookMeta(map[string]string{"webhook": "hmac", "webhookSecret": "hook", "replayProtection": "false"})
+	assert.Nil(t, err)
+	assert.False(t, opts.ReplayProtection)
+}
+
+func TestVerifyForges(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	github := newTestVerifier(t, map[string]string{"webhook": "github", "webhookSecret": "hook"})
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(sign256("s3cret", string(body))))
+	req.Header.Set("X-GitHub-Delivery", "d1")
+	assert.Nil(t, github.Verify(req, body))
+	// the same delivery is replayed, with a fresh delivery id too
+	assert.NotNil(t, github.Verify(req, body))
+	req.Header.Set("X-GitHub-Delivery", "d2")
+	assert.NotNil(t, github.Verify(req, body))
+	assert.NotNil(t, github.Verify(req, []byte(`{"ref":"refs/heads/evil"}`)))
+
+	// sha1 signature is not accepted unless allowed
+	mac := hmac.New(sha1.New, []byte("s3cret"))
+	mac.Write(body)
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+	assert.NotNil(t, github.Verify(req, body))
+	legacy := newTestVerifier(t, map[string]string{"webhook": "github", "webhookSecret": "hook", "allowSha1Signature": "true"})
+	assert.Nil(t, legacy.Verify(req, body))
+	_, err := parseWebhookMeta(map[string]string{"webhook": "gitea", "webhookSecret": "hook", "allowSha1Signature": "true"})
+	assert.NotNil(t, err)
+
+	gitlab := newTestVerifier(t, map[string]string{"webhook": "gitlab", "webhookSecret": "hook"})
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Gitlab-Token", "s3cret")
+	assert.Nil(t, gitlab.Verify(req, body))
+	assert.NotNil(t, gitlab.Verify(req, body))
+	assert.Nil(t, gitlab.Verify(req, []byte(`{"ref":"refs/heads/dev"}`)))
+	req.Header.Set("X-Gitlab-Token", "wrong")
+	assert.NotNil(t, gitlab.Verify(req, body))
+
+	gitea := newTestVerifier(t, map[string]string{"webhook": "gitea", "webhookSecret": "hook"})
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Gitea-Signature", hex.EncodeToString(sign256("s3cret", string(body))))
+	assert.Nil(t, gitea.Verify(req, body))
+
+	bitbucket := newTestVerifier(t, map[string]string{"webhook": "bitbucket", "webhookSecret": "hook"})
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(sign256("s3cret", string(body))))
+	assert.Nil(t, bitbucket.Verify(req, body))
+	req.Header.Del("X-Hub-Signature")
+	assert.NotNil(t, bitbucket.Verify(req, body))
+}
+
+func TestVerifyGenericHmac(t *testing.T) {
+	body := []byte(`{"a":1}`)
+	v := newTestVerifier(t, map[string]string{
+		"webhook":            "hmac",
+		"webhookSecret":      "hook",
+		"signatureHeader":    "X-Sig",
+		"signatureEncoding":  "base64",
+		"timestampHeader":    "X-Timestamp",
+		"timestampTolerance": "60",
+	})
+	signed := func(ts int64) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		s := strconv.FormatInt(ts, 10)
+		req.Header.Set("X-Timestamp", s)
+		req.Header.Set("X-Sig", base64.StdEncoding.EncodeToString(sign256("s3cret", s+"."+string(body))))
+		return req
+	}
+	now := time.Now().Unix()
+	assert.Nil(t, v.Verify(signed(now), body))
+	assert.NotNil(t, v.Verify(signed(now), body))
+	assert.Nil(t, v.Verify(signed(now-1), body))
+	assert.NotNil(t, v.Verify(signed(now-120), body))
+	assert.NotNil(t, v.Verify(signed(now+120), body))
+
+	req := signed(now - 2)
+	req.Header.Set("X-Timestamp", strconv.FormatInt(now-3, 10))
+	assert.NotNil(t, v.Verify(req, body))
+}
+
+func TestCheckReplayBounded(t *testing.T) {
+	v := newTestVerifier(t, map[string]string{"webhook": "github", "webhookSecret": "hook", "timestampTolerance": "1"})
+	for i := 0; i < maxWebhookDeliveries+10; i++ {
+		assert.Nil(t, v.checkReplay(strconv.Itoa(i)))
+	}
+	assert.Len(t, v.deliveries.Keys(), maxWebhookDeliveries)
+	assert.NotNil(t, v.checkReplay(strconv.Itoa(maxWebhookDeliveries)))
+
+	time.Sleep(1100 * time.Millisecond)
+	assert.Nil(t, v.checkReplay(strconv.Itoa(maxWebhookDeliveries)))
+}